@@ -0,0 +1,106 @@
+package ctxtg
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// CustomClaims is implemented by user-defined struct embedding Claims, like
+//
+//	type MyClaims struct {
+//		ctxtg.Claims
+//		Plan string `json:"plan"`
+//	}
+//
+// Embedded Claims are encoded as usual, other fields are encoded as private JWT claims
+// with encoding/json, so they should not use names of registered or Claims claims.
+type CustomClaims interface {
+	standardClaims() *Claims
+}
+
+func (c *Claims) standardClaims() *Claims {
+	return c
+}
+
+// CustomClaimsParser is implemented by TokenParsers which support CustomClaims
+type CustomClaimsParser interface {
+	ParseInto(Token, CustomClaims) error
+}
+
+// CustomClaimsSigner is implemented by TokenSigners which support CustomClaims
+type CustomClaimsSigner interface {
+	SignClaims(c CustomClaims, timeout time.Duration) (Token, error)
+}
+
+// ParseInto parses JWT token like Parse and, if token valid, fills c with its claims
+func (p *jwtParser) ParseInto(t Token, c CustomClaims) error {
+	claims, token, err := p.parse(t)
+	if err != nil {
+		return err
+	}
+	payload, err := jwt.DecodeSegment(strings.Split(token.Raw, ".")[1])
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, c); err != nil {
+		return ErrInvalidToken
+	}
+	*c.standardClaims() = *claims
+	return nil
+}
+
+// SignClaims signs and encodes c with timeout like Sign, returns signed Token or error
+func (s *jwtSigner) SignClaims(c CustomClaims, timeout time.Duration) (Token, error) {
+	std, err := s.jwtClaims(*c.standardClaims(), timeout)
+	if err != nil {
+		return "", err
+	}
+	claims, err := customJWTClaims(c, std)
+	if err != nil {
+		return "", err
+	}
+	return s.sign(claims)
+}
+
+// customJWTClaims merges private claims of c with standard claims, standard ones take precedence
+func customJWTClaims(c CustomClaims, standard jwtClaims) (jwt.MapClaims, error) {
+	claims, err := jsonObject(c)
+	if err != nil {
+		return nil, err
+	}
+	embedded, err := jsonObject(c.standardClaims())
+	if err != nil {
+		return nil, err
+	}
+	for k := range embedded {
+		delete(claims, k)
+	}
+	std, err := jsonObject(standard)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range std {
+		claims[k] = v
+	}
+	return claims, nil
+}
+
+// jsonObject returns fields of JSON encoded v keeping their encoding
+func jsonObject(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var o map[string]json.RawMessage
+	if err := json.Unmarshal(b, &o); err != nil {
+		return nil, err
+	}
+	m := make(map[string]interface{}, len(o))
+	for k, v := range o {
+		m[k] = v
+	}
+	return m, nil
+}
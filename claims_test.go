@@ -0,0 +1,123 @@
+package ctxtg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type testCustomClaims struct {
+	Claims
+	Plan  string   `json:"plan"`
+	Quota int64    `json:"quota"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+func TestSignClaimsParseInto(t *testing.T) {
+	claims := testCustomClaims{
+		Claims: Claims{
+			UserID: 3,
+			Roles:  []string{"admin"},
+		},
+		Plan:  "pro",
+		Quota: 1<<53 + 1,
+		Tags:  []string{"a", "b"},
+	}
+	var signers []CustomClaimsSigner
+	for _, s := range testKeySetSigners(t) {
+		signers = append(signers, s.(CustomClaimsSigner))
+	}
+	p := testKeySetTokenParser(t)
+	for _, s := range signers {
+		token, err := s.SignClaims(&claims, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c testCustomClaims
+		if err := p.ParseInto(token, &c); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if c.TokenID == "" || c.IssuedAt.IsZero() {
+			t.Errorf("Signer should stamp jti and iat %v", c)
+		}
+		c.TokenID, c.IssuedAt = "", time.Time{}
+		if !reflect.DeepEqual(c, claims) {
+			t.Errorf("Invalid claims %#v, expected %#v", c, claims)
+		}
+		std, err := p.Parse(token)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		std.TokenID, std.IssuedAt = "", time.Time{}
+		if !reflect.DeepEqual(*std, claims.Claims) {
+			t.Errorf("Invalid claims %#v", std)
+		}
+	}
+}
+
+func TestSignClaimsStandardClaims(t *testing.T) {
+	claims := struct {
+		testCustomClaims
+		Sub string `json:"sub"`
+	}{
+		testCustomClaims: testCustomClaims{Claims: Claims{UserID: 3}},
+		Sub:              "4",
+	}
+	token, err := testRSATokenSigner(t).SignClaims(&claims, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c jwt.MapClaims
+	if _, err := new(jwt.Parser).ParseWithClaims(string(token), &c, func(*jwt.Token) (interface{}, error) {
+		return testPublicKey(t), nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"UserID", "Roles", "Scopes", "TenantID", "SessionID"} {
+		if _, ok := c[k]; ok {
+			t.Errorf("Embedded Claims field %v encoded", k)
+		}
+	}
+	if c["sub"] != "3" || c["plan"] != "" {
+		t.Errorf("Invalid claims %v", c)
+	}
+}
+
+func TestParseIntoOldToken(t *testing.T) {
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}))
+	var c testCustomClaims
+	if err := testRSATokenParser(t).ParseInto(token, &c); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.UserID != 3 || c.Plan != "" {
+		t.Errorf("Invalid claims %v", c)
+	}
+}
+
+func TestParseIntoErr(t *testing.T) {
+	tests := []struct {
+		claims jwt.MapClaims
+		err    error
+	}{
+		{jwt.MapClaims{"sub": "3", "exp": time.Now().Add(-5 * time.Second).Unix()}, ErrTokenExpired},
+		{jwt.MapClaims{"sub": "user", "exp": time.Now().Add(5 * time.Second).Unix()}, ErrInvalidToken},
+		{jwt.MapClaims{"sub": "3", "exp": time.Now().Add(5 * time.Second).Unix(), "quota": "many"}, ErrInvalidToken},
+	}
+	p := testRSATokenParser(t)
+	for _, test := range tests {
+		token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, test.claims))
+		var c testCustomClaims
+		if err := p.ParseInto(token, &c); !errors.Is(err, test.err) {
+			t.Errorf("Expected error %v, got %v", test.err, err)
+		}
+	}
+	if err := p.ParseInto("invalid", &testCustomClaims{}); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+}
@@ -25,40 +25,76 @@ type Token string
 
 // Context for microservices communication
 type Context struct {
-	Token     Token
-	Deadline  int64
+	Token Token
+	// Deadline in Unix seconds, kept for peers which don't know DeadlineNano
+	Deadline int64
+	// DeadlineNano is precise Deadline in Unix nanoseconds, it is ignored if doesn't match Deadline
+	DeadlineNano int64
+	// Budget is time left until deadline when Context was made, see FromContextWithBudget.
+	// If set it takes precedence over Deadline to avoid clock skew issues, negative value means deadline exceeded.
+	Budget    time.Duration
 	TracingID string
 	Data      map[string]interface{}
 }
 
-// ToContext convert to context.Context object
+// ToContext convert to context.Context object, Data is copied so c can be safely modified later
 func (c *Context) ToContext() (context.Context, context.CancelFunc) {
-	ctx, cancel := contextFromDeadline(c.Deadline)
+	return c.toContext(context.Background())
+}
+
+// toContext works like ToContext but derives returned context.Context from parent
+func (c *Context) toContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := contextFromDeadline(parent, c.deadline())
 	ctx = context.WithValue(ctx, TokenKey, c.Token)
 	ctx = context.WithValue(ctx, TracingIDKey, c.TracingID)
 	if c.Data != nil {
-		ctx = context.WithValue(ctx, DataKey, c.Data)
+		ctx = context.WithValue(ctx, DataKey, copyData(c.Data, 0))
 	}
 	return ctx, cancel
 }
 
-// FromContext convert context.Context to Context correctly extracting required fields
+// FromContext convert context.Context to Context correctly extracting required fields,
+// returned Data is a copy and can be safely modified
 func FromContext(ctx context.Context) Context {
 	return Context{
-		Token:     tokenValue(ctx),
-		Deadline:  unixDeadline(ctx),
-		TracingID: stringValue(ctx, TracingIDKey),
-		Data:      DataFromContext(ctx),
+		Token:        tokenValue(ctx),
+		Deadline:     unixDeadline(ctx),
+		DeadlineNano: unixNanoDeadline(ctx),
+		TracingID:    stringValue(ctx, TracingIDKey),
+		Data:         copyData(DataFromContext(ctx), 0),
+	}
+}
+
+// FromContextWithBudget works like FromContext but also fills Budget with time left until ctx deadline,
+// so receiver will calculate its deadline using own clock
+func FromContextWithBudget(ctx context.Context) Context {
+	c := FromContext(ctx)
+	if t, ok := ctx.Deadline(); ok {
+		c.Budget = t.Sub(timeNowFunc())
+		if c.Budget == 0 {
+			c.Budget = -1
+		}
+	}
+	return c
+}
+
+func fromContext(ctx context.Context, budget bool) Context {
+	if budget {
+		return FromContextWithBudget(ctx)
 	}
+	return FromContext(ctx)
 }
 
-// WithDataValue add key-value to Data map inside context.Context and return new context.Context
+// WithDataValue returns new context.Context with copy of parent Data map with added key-value.
+// Parent Data map isn't modified, so it's safe to use from different goroutines.
+// Limits aren't checked, see DataLimits.WithDataValue, but Context with reserved keys can't be sent.
 func WithDataValue(parent context.Context, key string, value interface{}) context.Context {
-	if d := DataFromContext(parent); d != nil {
-		d[key] = value
-		return parent
+	d := copyData(DataFromContext(parent), 1)
+	if d == nil {
+		d = make(map[string]interface{}, 1)
 	}
-	return context.WithValue(parent, DataKey, map[string]interface{}{key: value})
+	d[key] = value
+	return context.WithValue(parent, DataKey, d)
 }
 
 // ValueFromData returns value from Data map inside ctx or nil
@@ -69,7 +105,8 @@ func ValueFromData(ctx context.Context, key string) interface{} {
 	return nil
 }
 
-// DataFromContext returns map from Data key from ctx or nil
+// DataFromContext returns map from Data key from ctx or nil.
+// Returned map is shared with all derived contexts and must not be modified.
 func DataFromContext(ctx context.Context) map[string]interface{} {
 	v := ctx.Value(DataKey)
 	if m, ok := v.(map[string]interface{}); ok {
@@ -78,6 +115,18 @@ func DataFromContext(ctx context.Context) map[string]interface{} {
 	return nil
 }
 
+// copyData returns copy of d with capacity for extra keys or nil if d is nil
+func copyData(d map[string]interface{}, extra int) map[string]interface{} {
+	if d == nil {
+		return nil
+	}
+	c := make(map[string]interface{}, len(d)+extra)
+	for k, v := range d {
+		c[k] = v
+	}
+	return c
+}
+
 func unixDeadline(ctx context.Context) int64 {
 	if t, ok := ctx.Deadline(); ok {
 		return t.Unix()
@@ -85,6 +134,39 @@ func unixDeadline(ctx context.Context) int64 {
 	return 0
 }
 
+// contextErr returns ctx.Err() or context.DeadlineExceeded if ctx deadline passed but ctx isn't done yet
+func contextErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+func unixNanoDeadline(ctx context.Context) int64 {
+	if t, ok := ctx.Deadline(); ok {
+		return t.UnixNano()
+	}
+	return 0
+}
+
+// deadline returns deadline calculated from Budget if it is set or precise deadline if it matches Deadline,
+// zero time.Time if no deadline set
+func (c *Context) deadline() time.Time {
+	if c.Budget != 0 {
+		return timeNowFunc().Add(c.Budget)
+	}
+	if c.Deadline <= 0 {
+		return time.Time{}
+	}
+	if d := time.Unix(0, c.DeadlineNano); d.Unix() == c.Deadline {
+		return d
+	}
+	return time.Unix(c.Deadline, 0)
+}
+
 func tokenValue(ctx context.Context) Token {
 	v := ctx.Value(TokenKey)
 	if token, ok := v.(Token); ok {
@@ -101,15 +183,15 @@ func stringValue(ctx context.Context, key interface{}) string {
 	return ""
 }
 
-func contextFromDeadline(deadline int64) (context.Context, context.CancelFunc) {
+func contextFromDeadline(parent context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
 	var (
 		ctx    context.Context
 		cancel context.CancelFunc
 	)
-	if deadline <= 0 {
-		ctx, cancel = context.WithCancel(context.Background())
+	if deadline.IsZero() {
+		ctx, cancel = context.WithCancel(parent)
 	} else {
-		ctx, cancel = context.WithDeadline(context.Background(), time.Unix(deadline, 0))
+		ctx, cancel = context.WithDeadline(parent, deadline)
 	}
 	return ctx, cancel
 }
@@ -2,6 +2,8 @@ package ctxtg
 
 import (
 	"reflect"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -72,6 +74,46 @@ func TestToContext(t *testing.T) {
 	}
 }
 
+func TestToContextDeadlineNano(t *testing.T) {
+	deadline := time.Now().Add(10*time.Second + 300*time.Millisecond)
+	c := Context{
+		Deadline:     deadline.Unix(),
+		DeadlineNano: deadline.UnixNano(),
+	}
+	ctx, cancel := c.ToContext()
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(deadline) {
+		t.Errorf("Invalid deadline %v %v", d, ok)
+	}
+}
+
+func TestToContextDeadlineNanoMismatch(t *testing.T) {
+	deadline := time.Now().Add(10 * time.Second)
+	c := Context{
+		Deadline:     deadline.Unix() + 5,
+		DeadlineNano: deadline.UnixNano(),
+	}
+	ctx, cancel := c.ToContext()
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || d.UnixNano() != time.Unix(c.Deadline, 0).UnixNano() {
+		t.Errorf("Invalid deadline %v %v", d, ok)
+	}
+}
+
+func TestToContextBudget(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	c := Context{
+		Deadline: now.Add(-time.Hour).Unix(),
+		Budget:   3 * time.Second,
+	}
+	ctx, cancel := c.ToContext()
+	defer cancel()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(now.Add(c.Budget)) {
+		t.Errorf("Invalid deadline %v %v", d, ok)
+	}
+}
+
 func TestEmptyToContext(t *testing.T) {
 	var c Context
 	ctx, cancel := c.ToContext()
@@ -115,6 +157,9 @@ func TestFromContext(t *testing.T) {
 	if c.Deadline != deadline {
 		t.Errorf("Invalid deadline %v", c.Deadline)
 	}
+	if c.DeadlineNano != time.Unix(deadline, 0).UnixNano() {
+		t.Errorf("Invalid deadline nano %v", c.DeadlineNano)
+	}
 	if c.Token != token {
 		t.Errorf("Invalid token %v", c.Token)
 	}
@@ -152,6 +197,39 @@ func TestFromToContext(t *testing.T) {
 	}
 }
 
+func TestFromContextWithBudget(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	deadline := now.Add(5 * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	c := FromContextWithBudget(ctx)
+	if c.Budget != 5*time.Second {
+		t.Errorf("Invalid budget %v", c.Budget)
+	}
+	if c.Deadline != deadline.Unix() || c.DeadlineNano != deadline.UnixNano() {
+		t.Errorf("Invalid deadline %v %v", c.Deadline, c.DeadlineNano)
+	}
+}
+
+func TestFromContextWithBudgetExceeded(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	ctx, cancel := context.WithDeadline(context.Background(), now)
+	defer cancel()
+
+	if c := FromContextWithBudget(ctx); c.Budget >= 0 {
+		t.Errorf("Invalid budget %v", c.Budget)
+	}
+}
+
+func TestFromContextWithBudgetNoDeadline(t *testing.T) {
+	if c := FromContextWithBudget(context.Background()); c.Budget != 0 {
+		t.Errorf("Invalid budget %v", c.Budget)
+	}
+}
+
 func TestEmptyFromContext(t *testing.T) {
 	c := FromContext(context.Background())
 
@@ -195,3 +273,90 @@ func TestValueFromDataWithEmptyCtx(t *testing.T) {
 		t.Errorf("Context without data should return nil")
 	}
 }
+
+func TestWithDataValueDoesNotModifyParent(t *testing.T) {
+	parent := WithDataValue(context.Background(), "k", 1)
+	child := WithDataValue(parent, "k2", 2)
+	if v := ValueFromData(parent, "k2"); v != nil {
+		t.Errorf("Parent modified %v", v)
+	}
+	if v := ValueFromData(child, "k"); v != 1 {
+		t.Errorf("Invalid parent value in child %v", v)
+	}
+	if v := ValueFromData(child, "k2"); v != 2 {
+		t.Errorf("Invalid child value %v", v)
+	}
+}
+
+func TestToContextCopiesData(t *testing.T) {
+	c := Context{
+		Data: map[string]interface{}{"k": 1},
+	}
+	ctx, cancel := c.ToContext()
+	defer cancel()
+	c.Data["k"] = 2
+	if v := ValueFromData(ctx, "k"); v != 1 {
+		t.Errorf("Context data modified %v", v)
+	}
+}
+
+func TestFromContextCopiesData(t *testing.T) {
+	ctx := WithDataValue(context.Background(), "k", 1)
+	c := FromContext(ctx)
+	c.Data["k"] = 2
+	if v := ValueFromData(ctx, "k"); v != 1 {
+		t.Errorf("Context data modified %v", v)
+	}
+}
+
+func TestConcurrentWithDataValue(t *testing.T) {
+	parent := WithDataValue(context.Background(), "parent", -1)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			k := strconv.Itoa(i)
+			child := WithDataValue(parent, k, i)
+			for j := 0; j < 10; j++ {
+				child = WithDataValue(child, k+"."+strconv.Itoa(j), j)
+			}
+			if v := ValueFromData(child, k); v != i {
+				t.Errorf("Invalid value %v", v)
+			}
+			if d := DataFromContext(child); len(d) != 12 {
+				t.Errorf("Sibling values leaked %v", d)
+			}
+			if v := ValueFromData(child, "parent"); v != -1 {
+				t.Errorf("Invalid parent value %v", v)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if d := DataFromContext(parent); len(d) != 1 {
+		t.Errorf("Parent modified %v", d)
+	}
+}
+
+func TestConcurrentFromToContext(t *testing.T) {
+	parent := WithDataValue(context.Background(), "k", 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := FromContext(parent)
+			c.Data["k"] = i
+			ctx, cancel := c.ToContext()
+			defer cancel()
+			c.Data["k"] = -i
+			if v := ValueFromData(ctx, "k"); v != i {
+				t.Errorf("Invalid value %v", v)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if v := ValueFromData(parent, "k"); v != 0 {
+		t.Errorf("Parent modified %v", v)
+	}
+}
@@ -3,6 +3,7 @@ package ctxtgtest
 
 import (
 	"errors"
+	"reflect"
 	"time"
 
 	"github.com/qarea/ctxtg"
@@ -98,7 +99,7 @@ func (s *Signer) Error() error {
 	if !s.called {
 		return ErrMethodNotCalled
 	}
-	if s.ClaimsExpected != s.claims {
+	if !reflect.DeepEqual(s.ClaimsExpected, s.claims) {
 		return ErrUnexpectedClaims
 	}
 	if s.TimeoutExpected != s.timeout {
@@ -0,0 +1,285 @@
+package ctxtg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// ReservedDataPrefix is prefix of Data keys owned by ctxtg
+const ReservedDataPrefix = "ctxtg."
+
+// Errors for Data limits, returned wrapped into *DataLimitError
+var (
+	ErrDataTooManyKeys = errors.New("ctxtg: too many Data keys")
+	ErrDataKeyTooLong  = errors.New("ctxtg: Data key is too long")
+	ErrDataTooLarge    = errors.New("ctxtg: Data is too large")
+	ErrDataKeyReserved = errors.New("ctxtg: Data key is reserved")
+)
+
+// DefaultDataLimits returns limits enforced by EncodeHeader, DecodeHeader, WrapRPC and by
+// Transport, HTTPHandler and RPCClient without Limits.
+// Outgoing Data with reserved keys is rejected by header codec and RPCClient,
+// reserved keys of incoming Data are dropped by header codec and WrapRPC,
+// so only ctxtg can set them.
+func DefaultDataLimits() DataLimits {
+	return DataLimits{
+		MaxKeys:          64,
+		MaxKeyLen:        128,
+		MaxSize:          16 << 10,
+		ReservedPrefixes: []string{ReservedDataPrefix},
+	}
+}
+
+// limitsOrDefault returns *l or DefaultDataLimits if l is nil
+func limitsOrDefault(l *DataLimits) DataLimits {
+	if l == nil {
+		return DefaultDataLimits()
+	}
+	return *l
+}
+
+// DataLimits restricts Data passed between services
+type DataLimits struct {
+	// MaxKeys is max number of Data keys, 0 means no limit
+	MaxKeys int
+	// MaxKeyLen is max length of Data key in bytes, 0 means no limit
+	MaxKeyLen int
+	// MaxSize is max size of JSON encoded Data in bytes, 0 means no limit
+	MaxSize int
+	// ReservedPrefixes are prefixes of keys which can't be added with DataLimits.WithDataValue or sent to other services
+	ReservedPrefixes []string
+}
+
+// DataLimitError describes violation of DataLimits
+type DataLimitError struct {
+	// Key violating limits, empty if limit is for whole Data
+	Key string
+	// Err is one of ErrData* errors
+	Err error
+}
+
+func (e *DataLimitError) Error() string {
+	if e.Key == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Key
+}
+
+// Unwrap returns Err
+func (e *DataLimitError) Unwrap() error {
+	return e.Err
+}
+
+// Check returns *DataLimitError if data violates number of keys, key length or size limits.
+// Reserved keys aren't checked.
+func (l DataLimits) Check(data map[string]interface{}) error {
+	if l.MaxKeys > 0 && len(data) > l.MaxKeys {
+		return &DataLimitError{Err: ErrDataTooManyKeys}
+	}
+	if l.MaxKeyLen > 0 {
+		for k := range data {
+			if len(k) > l.MaxKeyLen {
+				return &DataLimitError{Key: k, Err: ErrDataKeyTooLong}
+			}
+		}
+	}
+	if l.MaxSize > 0 && len(data) > 0 {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		if len(b) > l.MaxSize {
+			return &DataLimitError{Err: ErrDataTooLarge}
+		}
+	}
+	return nil
+}
+
+// WithDataValue works like WithDataValue function but returns *DataLimitError
+// if key is reserved or resulting Data violates l
+func (l DataLimits) WithDataValue(parent context.Context, key string, value interface{}) (context.Context, error) {
+	if l.reserved(key) {
+		return nil, &DataLimitError{Key: key, Err: ErrDataKeyReserved}
+	}
+	ctx := WithDataValue(parent, key, value)
+	if err := l.Check(DataFromContext(ctx)); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// checkOutgoing works like Check but also returns *DataLimitError if data has reserved keys
+func (l DataLimits) checkOutgoing(data map[string]interface{}) error {
+	for k := range data {
+		if l.reserved(k) {
+			return &DataLimitError{Key: k, Err: ErrDataKeyReserved}
+		}
+	}
+	return l.Check(data)
+}
+
+// dropReserved removes reserved keys from data
+func (l DataLimits) dropReserved(data map[string]interface{}) {
+	for k := range data {
+		if l.reserved(k) {
+			delete(data, k)
+		}
+	}
+}
+
+func (l DataLimits) reserved(key string) bool {
+	for _, p := range l.ReservedPrefixes {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// TypedKey is a key of Data map with value of type T.
+//
+// Values which came from other services are often decoded from JSON and
+// can have other type than T, Get converts them using next rules:
+//   - value of type T is returned as is
+//   - value of other type with the same kind as T (e.g. string for named string type) is converted to T
+//   - numbers (including json.Number) are converted to numeric T only if value fits into T exactly,
+//     so 3.0 can be got as int but 3.5 can't, integers are converted to floats as is
+//   - time.Duration is got from number of nanoseconds (as json encodes it) or from time.ParseDuration string
+//   - time.Time is got from RFC 3339 string (as json encodes it)
+//   - slices, arrays, maps and structs are converted through JSON (e.g. []interface{} to []string)
+//
+// So values of any JSON compatible T set with With can be got after Context is sent over HTTP or jsonrpc2.
+// nil and values which can't be converted are reported as missing.
+type TypedKey[T any] string
+
+// Get returns value of k from Data inside ctx converted to T, false if value is missing or can't be converted
+func (k TypedKey[T]) Get(ctx context.Context) (T, bool) {
+	return k.From(DataFromContext(ctx))
+}
+
+// From returns value of k from Data map converted to T, false if value is missing or can't be converted
+func (k TypedKey[T]) From(data map[string]interface{}) (T, bool) {
+	return convertData[T](data[string(k)])
+}
+
+// With adds value of k to Data map inside context.Context and returns new context.Context, see WithDataValue
+func (k TypedKey[T]) With(parent context.Context, value T) context.Context {
+	return WithDataValue(parent, string(k), value)
+}
+
+func convertData[T any](v interface{}) (T, bool) {
+	var zero T
+	if t, ok := v.(T); ok || v == nil {
+		return t, ok
+	}
+	target := reflect.TypeOf(&zero).Elem()
+	rv := reflect.ValueOf(v)
+	if s, ok := v.(string); ok {
+		switch p := interface{}(&zero).(type) {
+		case *time.Duration:
+			d, err := time.ParseDuration(s)
+			*p = d
+			return zero, err == nil
+		case *time.Time:
+			t, err := time.Parse(time.RFC3339Nano, s)
+			*p = t
+			return zero, err == nil
+		}
+	}
+	if rv.Kind() == target.Kind() && rv.Type().ConvertibleTo(target) {
+		return rv.Convert(target).Interface().(T), true
+	}
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			rv = reflect.ValueOf(i)
+		} else if f, err := n.Float64(); err == nil {
+			rv = reflect.ValueOf(f)
+		} else {
+			return zero, false
+		}
+	}
+	res := reflect.New(target).Elem()
+	switch target.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, ok := dataInt(rv)
+		if !ok || res.OverflowInt(i) {
+			return zero, false
+		}
+		res.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, ok := dataUint(rv)
+		if !ok || res.OverflowUint(u) {
+			return zero, false
+		}
+		res.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, ok := dataFloat(rv)
+		if !ok || res.OverflowFloat(f) {
+			return zero, false
+		}
+		res.SetFloat(f)
+	case reflect.Slice, reflect.Array, reflect.Map, reflect.Struct:
+		return convertJSON[T](v)
+	default:
+		return zero, false
+	}
+	return res.Interface().(T), true
+}
+
+func convertJSON[T any](v interface{}) (T, bool) {
+	var res T
+	b, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(b, &res)
+	}
+	if err != nil {
+		var zero T
+		return zero, false
+	}
+	return res, true
+}
+
+func dataInt(v reflect.Value) (int64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := v.Uint()
+		return int64(u), u <= math.MaxInt64
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		return int64(f), f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64
+	}
+	return 0, false
+}
+
+func dataUint(v reflect.Value) (uint64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i := v.Int()
+		return uint64(i), i >= 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		f := v.Float()
+		return uint64(f), f == math.Trunc(f) && f >= 0 && f < math.MaxUint64
+	}
+	return 0, false
+}
+
+func dataFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
@@ -0,0 +1,197 @@
+package ctxtg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTypedKey(t *testing.T) {
+	k := TypedKey[int]("k")
+	ctx := k.With(context.Background(), 5)
+	if v, ok := k.Get(ctx); !ok || v != 5 {
+		t.Errorf("Invalid value %v %v", v, ok)
+	}
+	if v, ok := TypedKey[int]("missing").Get(ctx); ok || v != 0 {
+		t.Errorf("Value should be missing %v %v", v, ok)
+	}
+	if v, ok := TypedKey[string]("k").Get(ctx); ok || v != "" {
+		t.Errorf("Value should not be converted %v %v", v, ok)
+	}
+}
+
+func TestTypedKeyJSON(t *testing.T) {
+	type ID int64
+	now := time.Now()
+	c := Context{
+		Data: map[string]interface{}{
+			"int":      3,
+			"duration": 3 * time.Second,
+			"time":     now,
+			"token":    Token("token"),
+			"id":       ID(5),
+		},
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c2 Context
+	if err := json.Unmarshal(b, &c2); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := TypedKey[int]("int").From(c2.Data); !ok || v != 3 {
+		t.Errorf("Invalid int %v %v", v, ok)
+	}
+	if v, ok := TypedKey[time.Duration]("duration").From(c2.Data); !ok || v != 3*time.Second {
+		t.Errorf("Invalid duration %v %v", v, ok)
+	}
+	if v, ok := TypedKey[time.Time]("time").From(c2.Data); !ok || !v.Equal(now) {
+		t.Errorf("Invalid time %v %v", v, ok)
+	}
+	if v, ok := TypedKey[Token]("token").From(c2.Data); !ok || v != "token" {
+		t.Errorf("Invalid token %v %v", v, ok)
+	}
+	if v, ok := TypedKey[ID]("id").From(c2.Data); !ok || v != 5 {
+		t.Errorf("Invalid id %v %v", v, ok)
+	}
+}
+
+func TestTypedKeyHeader(t *testing.T) {
+	type ID uint
+	now := time.Now()
+	ctx := context.Background()
+	ctx = TypedKey[ID]("id").With(ctx, 5)
+	ctx = TypedKey[int32]("int32").With(ctx, -3)
+	ctx = TypedKey[time.Time]("time").With(ctx, now)
+	ctx = TypedKey[[]string]("slice").With(ctx, []string{"a", "b"})
+	ctx = TypedKey[time.Duration]("duration").With(ctx, time.Second)
+	h := make(http.Header)
+	if err := EncodeHeader(h, FromContext(ctx)); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	c, err := DecodeHeader(h)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if v, ok := TypedKey[ID]("id").From(c.Data); !ok || v != 5 {
+		t.Errorf("Invalid id %v %v", v, ok)
+	}
+	if v, ok := TypedKey[int32]("int32").From(c.Data); !ok || v != -3 {
+		t.Errorf("Invalid int32 %v %v", v, ok)
+	}
+	if v, ok := TypedKey[time.Time]("time").From(c.Data); !ok || !v.Equal(now) {
+		t.Errorf("Invalid time %v %v", v, ok)
+	}
+	if v, ok := TypedKey[[]string]("slice").From(c.Data); !ok || !reflect.DeepEqual(v, []string{"a", "b"}) {
+		t.Errorf("Invalid slice %v %v", v, ok)
+	}
+	if v, ok := TypedKey[time.Duration]("duration").From(c.Data); !ok || v != time.Second {
+		t.Errorf("Invalid duration %v %v", v, ok)
+	}
+}
+
+func TestConvertData(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		f    func(interface{}) (interface{}, bool)
+		want interface{}
+		ok   bool
+	}{
+		{nil, convertTo[int], 0, false},
+		{nil, convertTo[interface{}], nil, false},
+		{"s", convertTo[interface{}], "s", true},
+		{3.0, convertTo[int], 3, true},
+		{3.5, convertTo[int], 0, false},
+		{-1.0, convertTo[uint], uint(0), false},
+		{300.0, convertTo[int8], int8(0), false},
+		{1e30, convertTo[int64], int64(0), false},
+		{int64(-3), convertTo[int32], int32(-3), true},
+		{uint64(1 << 63), convertTo[int64], int64(0), false},
+		{3, convertTo[float64], 3.0, true},
+		{1e300, convertTo[float32], float32(0), false},
+		{json.Number("7"), convertTo[uint16], uint16(7), true},
+		{json.Number("7.5"), convertTo[float64], 7.5, true},
+		{json.Number("7.5"), convertTo[int], 0, false},
+		{json.Number("x"), convertTo[int], 0, false},
+		{json.Number("7"), convertTo[string], "7", true},
+		{"1m", convertTo[time.Duration], time.Minute, true},
+		{"x", convertTo[time.Duration], time.Duration(0), false},
+		{1e9, convertTo[time.Duration], time.Second, true},
+		{"x", convertTo[time.Time], time.Time{}, false},
+		{"3", convertTo[int], 0, false},
+		{true, convertTo[string], "", false},
+		{[]interface{}{1.0}, convertTo[[]int], []int{1}, true},
+		{[]interface{}{"a"}, convertTo[[]int], []int(nil), false},
+		{map[string]interface{}{"A": "a"}, convertTo[struct{ A string }], struct{ A string }{"a"}, true},
+		{"a", convertTo[[]string], []string(nil), false},
+	}
+	for _, test := range tests {
+		v, ok := test.f(test.v)
+		if ok != test.ok || !reflect.DeepEqual(v, test.want) {
+			t.Errorf("Invalid conversion of %#v: %#v %v", test.v, v, ok)
+		}
+	}
+}
+
+func convertTo[T any](v interface{}) (interface{}, bool) {
+	res, ok := convertData[T](v)
+	return res, ok
+}
+
+func TestDataLimitsCheck(t *testing.T) {
+	l := DataLimits{
+		MaxKeys:   2,
+		MaxKeyLen: 3,
+		MaxSize:   20,
+	}
+	tests := []struct {
+		data map[string]interface{}
+		err  error
+		key  string
+	}{
+		{nil, nil, ""},
+		{map[string]interface{}{"a": 1, "b": 2}, nil, ""},
+		{map[string]interface{}{"a": 1, "b": 2, "c": 3}, ErrDataTooManyKeys, ""},
+		{map[string]interface{}{"long": 1}, ErrDataKeyTooLong, "long"},
+		{map[string]interface{}{"a": strings.Repeat("a", 20)}, ErrDataTooLarge, ""},
+	}
+	for _, test := range tests {
+		err := l.Check(test.data)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Unexpected error %v for %v", err, test.data)
+		}
+		var e *DataLimitError
+		if errors.As(err, &e) && e.Key != test.key {
+			t.Errorf("Invalid key %v", e.Key)
+		}
+	}
+	if err := (DataLimits{}).Check(map[string]interface{}{strings.Repeat("a", 1000): 1}); err != nil {
+		t.Errorf("Zero limits should not be checked %v", err)
+	}
+}
+
+func TestDataLimitsWithDataValue(t *testing.T) {
+	l := DataLimits{
+		MaxKeys:          1,
+		ReservedPrefixes: []string{ReservedDataPrefix},
+	}
+	ctx, err := l.WithDataValue(context.Background(), "k", 1)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if v := ValueFromData(ctx, "k"); v != 1 {
+		t.Errorf("Invalid value %v", v)
+	}
+	if _, err := l.WithDataValue(ctx, "k2", 2); !errors.Is(err, ErrDataTooManyKeys) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := l.WithDataValue(context.Background(), ReservedDataPrefix+"k", 1); !errors.Is(err, ErrDataKeyReserved) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package ctxtg
+
+import (
+	"crypto/elliptic"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrUnsupportedCurve returned for ECDSA keys with curve other than P-256, P-384 or P-521
+var ErrUnsupportedCurve = errors.New("ctxtg: unsupported ECDSA curve")
+
+// NewECDSATokenParser parse publicKey and return correct instance or error.
+// Signing method (ES256, ES384 or ES512) is selected by key curve.
+func NewECDSATokenParser(publicKey []byte, opts ...ParserOption) (*ECDSATokenParser, error) {
+	k, err := jwt.ParseECPublicKeyFromPEM(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ecdsaSigningMethod(k.Curve); err != nil {
+		return nil, err
+	}
+	return &ECDSATokenParser{
+		jwtParser: newJWTParser(publicKeyFunc(k), opts),
+	}, nil
+}
+
+// ECDSATokenParser for parsing JWT token signed with ECDSA key
+// Implements TokenParser
+type ECDSATokenParser struct {
+	jwtParser
+}
+
+// NewECDSATokenSigner parse privateKey and return correct instance.
+// Signing method (ES256, ES384 or ES512) is selected by key curve.
+func NewECDSATokenSigner(privateKey []byte, opts ...SignerOption) (*ECDSATokenSigner, error) {
+	k, err := jwt.ParseECPrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	m, err := ecdsaSigningMethod(k.Curve)
+	if err != nil {
+		return nil, err
+	}
+	return &ECDSATokenSigner{
+		jwtSigner: newJWTSigner(m, k, opts),
+	}, nil
+}
+
+// ECDSATokenSigner for signing JWT tokens with ECDSA key
+// Implements TokenSigner
+type ECDSATokenSigner struct {
+	jwtSigner
+}
+
+func ecdsaSigningMethod(c elliptic.Curve) (*jwt.SigningMethodECDSA, error) {
+	switch c {
+	case elliptic.P256():
+		return jwt.SigningMethodES256, nil
+	case elliptic.P384():
+		return jwt.SigningMethodES384, nil
+	case elliptic.P521():
+		return jwt.SigningMethodES512, nil
+	}
+	return nil, ErrUnsupportedCurve
+}
@@ -0,0 +1,124 @@
+package ctxtg
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Errors for Ed25519 keys parsing
+var (
+	ErrNotEd25519PrivateKey = errors.New("ctxtg: key is not a valid Ed25519 private key")
+	ErrNotEd25519PublicKey  = errors.New("ctxtg: key is not a valid Ed25519 public key")
+)
+
+// SigningMethodEdDSA implements EdDSA JWT signing method with Ed25519 keys, which is missing in jwt-go
+var SigningMethodEdDSA = &SigningMethodEd25519{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// SigningMethodEd25519 implements jwt.SigningMethod for Ed25519 keys
+type SigningMethodEd25519 struct{}
+
+// Alg returns "EdDSA"
+func (m *SigningMethodEd25519) Alg() string {
+	return "EdDSA"
+}
+
+// Verify checks signature of signingString with ed25519.PublicKey
+func (m *SigningMethodEd25519) Verify(signingString, signature string, key interface{}) error {
+	k, ok := key.(ed25519.PublicKey)
+	if !ok || len(k) != ed25519.PublicKeySize {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(k, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+// Sign signs signingString with ed25519.PrivateKey
+func (m *SigningMethodEd25519) Sign(signingString string, key interface{}) (string, error) {
+	k, ok := key.(ed25519.PrivateKey)
+	if !ok || len(k) != ed25519.PrivateKeySize {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(k, []byte(signingString))), nil
+}
+
+// NewEd25519TokenParser parse PKIX publicKey and return correct instance or error
+func NewEd25519TokenParser(publicKey []byte, opts ...ParserOption) (*Ed25519TokenParser, error) {
+	k, err := parseEd25519PublicKeyFromPEM(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Ed25519TokenParser{
+		jwtParser: newJWTParser(publicKeyFunc(k), opts),
+	}, nil
+}
+
+// Ed25519TokenParser for parsing JWT token signed with Ed25519 key
+// Implements TokenParser
+type Ed25519TokenParser struct {
+	jwtParser
+}
+
+// NewEd25519TokenSigner parse PKCS #8 privateKey and return correct instance
+func NewEd25519TokenSigner(privateKey []byte, opts ...SignerOption) (*Ed25519TokenSigner, error) {
+	k, err := parseEd25519PrivateKeyFromPEM(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Ed25519TokenSigner{
+		jwtSigner: newJWTSigner(SigningMethodEdDSA, k, opts),
+	}, nil
+}
+
+// Ed25519TokenSigner for signing JWT tokens with Ed25519 key
+// Implements TokenSigner
+type Ed25519TokenSigner struct {
+	jwtSigner
+}
+
+func parseEd25519PrivateKeyFromPEM(key []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pk, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, ErrNotEd25519PrivateKey
+	}
+	return pk, nil
+}
+
+func parseEd25519PublicKeyFromPEM(key []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	pk, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, ErrNotEd25519PublicKey
+	}
+	return pk, nil
+}
@@ -0,0 +1,206 @@
+package ctxtg
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/rpc"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// Global errors for all projects.
+// Errors with Data (like TokenTime) are returned as *Error with the same Code,
+// so check them with errors.Is instead of ==.
+var (
+	ErrInvalidToken          = jsonrpc2.NewError(1, "INVALID_TOKEN")
+	ErrTokenExpired          = jsonrpc2.NewError(2, "TOKEN_EXPIRED")
+	ErrInvalidIssuer         = jsonrpc2.NewError(3, "INVALID_ISSUER")
+	ErrInvalidAudience       = jsonrpc2.NewError(4, "INVALID_AUDIENCE")
+	ErrTokenNotValidYet      = jsonrpc2.NewError(5, "TOKEN_NOT_VALID_YET")
+	ErrInvalidSignature      = jsonrpc2.NewError(6, "INVALID_SIGNATURE")
+	ErrInvalidAlgorithm      = jsonrpc2.NewError(7, "INVALID_ALGORITHM")
+	ErrMissingSubject        = jsonrpc2.NewError(8, "MISSING_SUBJECT")
+	ErrTokenRevoked          = jsonrpc2.NewError(9, "TOKEN_REVOKED")
+	ErrUnknownKey            = jsonrpc2.NewError(10, "UNKNOWN_KEY")
+	ErrTokenUsedBeforeIssued = jsonrpc2.NewError(11, "TOKEN_USED_BEFORE_ISSUED")
+	ErrInvalidRefreshToken   = jsonrpc2.NewError(12, "INVALID_REFRESH_TOKEN")
+	ErrRefreshTokenExpired   = jsonrpc2.NewError(13, "REFRESH_TOKEN_EXPIRED")
+	ErrRefreshTokenReused    = jsonrpc2.NewError(14, "REFRESH_TOKEN_REUSED")
+	ErrTokenCheckUnavailable = jsonrpc2.NewError(15, "TOKEN_CHECK_UNAVAILABLE")
+)
+
+// tokenErrors are all global errors, indexed by Code
+var tokenErrors = map[int]*jsonrpc2.Error{}
+
+func init() {
+	for _, e := range []*jsonrpc2.Error{
+		ErrInvalidToken,
+		ErrTokenExpired,
+		ErrInvalidIssuer,
+		ErrInvalidAudience,
+		ErrTokenNotValidYet,
+		ErrInvalidSignature,
+		ErrInvalidAlgorithm,
+		ErrMissingSubject,
+		ErrTokenRevoked,
+		ErrUnknownKey,
+		ErrTokenUsedBeforeIssued,
+		ErrInvalidRefreshToken,
+		ErrRefreshTokenExpired,
+		ErrRefreshTokenReused,
+		ErrTokenCheckUnavailable,
+	} {
+		tokenErrors[e.Code] = e
+	}
+}
+
+// Error is global error with Data.
+// errors.Is reports it matches global error (or any *jsonrpc2.Error and *Error) with the same Code
+// and errors.As can convert it to *jsonrpc2.Error.
+type Error struct {
+	Code    int
+	Message string
+	Data    interface{}
+}
+
+func (e *Error) Error() string {
+	return e.jsonrpc2().Error()
+}
+
+// Is reports whether target is *jsonrpc2.Error or *Error with the same Code
+func (e *Error) Is(target error) bool {
+	switch t := target.(type) {
+	case *jsonrpc2.Error:
+		return t.Code == e.Code
+	case *Error:
+		return t.Code == e.Code
+	}
+	return false
+}
+
+// As sets target of type **jsonrpc2.Error to jsonrpc2 representation of e
+func (e *Error) As(target interface{}) bool {
+	if t, ok := target.(**jsonrpc2.Error); ok {
+		*t = e.jsonrpc2()
+		return true
+	}
+	return false
+}
+
+// HTTPStatus returns HTTP status for e, see HTTPStatus function
+func (e *Error) HTTPStatus() int {
+	return HTTPStatus(e)
+}
+
+func (e *Error) jsonrpc2() *jsonrpc2.Error {
+	return &jsonrpc2.Error{
+		Code:    e.Code,
+		Message: e.Message,
+		Data:    e.Data,
+	}
+}
+
+// HTTPStatus returns 401 for global errors, 403 for other jsonrpc2 errors,
+// 503 for ErrRevokerUnavailable and ErrTokenCheckUnavailable
+// and 500 for other errors without code, like failures of infrastructure
+func HTTPStatus(err error) int {
+	var e *jsonrpc2.Error
+	switch {
+	case errors.Is(err, ErrRevokerUnavailable), errors.Is(err, ErrTokenCheckUnavailable):
+		return http.StatusServiceUnavailable
+	case !errors.As(err, &e):
+		return http.StatusInternalServerError
+	case tokenErrors[e.Code] != nil:
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// TokenTime is Data of ErrTokenExpired, ErrTokenNotValidYet and ErrTokenUsedBeforeIssued errors returned by parsers.
+// All times are Unix seconds, Now is parser time, which helps clients to detect clock skew.
+type TokenTime struct {
+	ExpiresAt int64 `json:"exp,omitempty"`
+	NotBefore int64 `json:"nbf,omitempty"`
+	IssuedAt  int64 `json:"iat,omitempty"`
+	Now       int64 `json:"now"`
+}
+
+// TokenTimeFromError returns TokenTime from Data of jsonrpc2 err,
+// also when err was received from remote service
+func TokenTimeFromError(err error) (TokenTime, bool) {
+	var e *jsonrpc2.Error
+	if !errors.As(err, &e) || e.Data == nil {
+		return TokenTime{}, false
+	}
+	if t, ok := e.Data.(TokenTime); ok {
+		return t, true
+	}
+	b, err := json.Marshal(e.Data)
+	if err != nil {
+		return TokenTime{}, false
+	}
+	var t TokenTime
+	if err := json.Unmarshal(b, &t); err != nil {
+		return TokenTime{}, false
+	}
+	return t, true
+}
+
+func tokenTimeError(e *jsonrpc2.Error, c *jwtClaims, now time.Time) *Error {
+	return &Error{
+		Code:    e.Code,
+		Message: e.Message,
+		Data: TokenTime{
+			ExpiresAt: c.ExpiresAt,
+			NotBefore: c.NotBefore,
+			IssuedAt:  c.IssuedAt,
+			Now:       now.Unix(),
+		},
+	}
+}
+
+// validationError converts error returned by jwt-go parser to global error
+func validationError(err error) error {
+	ve, ok := err.(*jwt.ValidationError)
+	if !ok {
+		return ErrInvalidToken
+	}
+	var e *jsonrpc2.Error
+	if errors.As(ve.Inner, &e) {
+		// returned by keyFunc
+		return ve.Inner
+	}
+	switch {
+	case ve.Errors&jwt.ValidationErrorMalformed != 0:
+		return ErrInvalidToken
+	case ve.Errors&jwt.ValidationErrorUnverifiable != 0:
+		return ErrInvalidAlgorithm
+	case ve.Errors&jwt.ValidationErrorSignatureInvalid != 0:
+		return ErrInvalidSignature
+	}
+	return ErrInvalidToken
+}
+
+// clientError converts global errors returned by remote service to global errors,
+// keeping Data in *Error, other errors are returned as is
+func clientError(err error) error {
+	se, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	var e jsonrpc2.Error
+	if json.Unmarshal([]byte(se), &e) != nil || tokenErrors[e.Code] == nil {
+		return err
+	}
+	if e.Data == nil {
+		return tokenErrors[e.Code]
+	}
+	return &Error{
+		Code:    e.Code,
+		Message: e.Message,
+		Data:    e.Data,
+	}
+}
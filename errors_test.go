@@ -0,0 +1,140 @@
+package ctxtg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/rpc"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestParseErrors(t *testing.T) {
+	exp := time.Now().Add(5 * time.Second).Unix()
+	valid := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: exp,
+	}))
+	hmac, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: exp,
+	}).SignedString(publicRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKey, err := NewRSATokenSigner(privateRSA, WithKeyID("unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unknownKeyToken, err := unknownKey.Sign(Claims{UserID: 3}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		parser TokenParser
+		token  Token
+		err    error
+	}{
+		{testRSATokenParser(t), valid[:len(valid)-4] + "AAAA", ErrInvalidSignature},
+		{testRSATokenParser(t), Token(hmac), ErrInvalidAlgorithm},
+		{testRSATokenParser(t), "eyJhbGciOiJYWVoifQ.e30.AAAA", ErrInvalidAlgorithm},
+		{testRSATokenParser(t), "invalid", ErrInvalidToken},
+		{testKeySetTokenParser(t), unknownKeyToken, ErrUnknownKey},
+		{testKeySetTokenParser(t), valid, ErrUnknownKey},
+	}
+	for _, test := range tests {
+		_, err := test.parser.Parse(test.token)
+		if !errors.Is(err, test.err) {
+			t.Errorf("Expected error %v for %v, got %v", test.err, test.token, err)
+		}
+		var e *jsonrpc2.Error
+		if !errors.As(err, &e) {
+			t.Errorf("Expected jsonrpc2 error, got %T", err)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	err := fmt.Errorf("wrapped: %w", &Error{Code: ErrTokenExpired.Code, Message: ErrTokenExpired.Message, Data: TokenTime{ExpiresAt: 1, Now: 2}})
+	if !errors.Is(err, ErrTokenExpired) || !errors.Is(err, &Error{Code: ErrTokenExpired.Code}) {
+		t.Error("Should match ErrTokenExpired")
+	}
+	if errors.Is(err, ErrInvalidToken) {
+		t.Error("Should not match ErrInvalidToken")
+	}
+	var e *jsonrpc2.Error
+	if !errors.As(err, &e) || e.Code != ErrTokenExpired.Code || e.Data != (TokenTime{ExpiresAt: 1, Now: 2}) {
+		t.Errorf("Invalid jsonrpc2 error %v", e)
+	}
+	var ctxtgErr *Error
+	if !errors.As(err, &ctxtgErr) || ctxtgErr.HTTPStatus() != http.StatusUnauthorized {
+		t.Errorf("Invalid error %v", ctxtgErr)
+	}
+	if s := ctxtgErr.Error(); s != `{"code":2,"message":"TOKEN_EXPIRED","data":{"exp":1,"now":2}}` {
+		t.Errorf("Invalid error string %v", s)
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{ErrTokenRevoked, http.StatusUnauthorized},
+		{fmt.Errorf("wrapped: %w", ErrInvalidSignature), http.StatusUnauthorized},
+		{jsonrpc2.NewError(100, "OTHER"), http.StatusForbidden},
+		{errors.New("other"), http.StatusInternalServerError},
+		{fmt.Errorf("wrapped: %w", ErrJWKSFetch), http.StatusInternalServerError},
+		{fmt.Errorf("%w: %w", ErrRevokerUnavailable, errors.New("other")), http.StatusServiceUnavailable},
+		{ErrTokenCheckUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, test := range tests {
+		if status := HTTPStatus(test.err); status != test.status {
+			t.Errorf("Invalid status %v for %v", status, test.err)
+		}
+	}
+}
+
+func TestRPCClientErrors(t *testing.T) {
+	svc := &RPCTestService{parser: testRSATokenParser(t)}
+	jsonClient := testRPCClient(t, svc)
+	defer jsonClient.Close()
+	client := NewRPCClient(jsonClient)
+
+	var reply int
+	ctx := context.WithValue(context.Background(), TokenKey, Token("invalid"))
+	if err := client.Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	expired := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(-5 * time.Second).Unix(),
+	}))
+	ctx = context.WithValue(context.Background(), TokenKey, expired)
+	err := client.Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply)
+	if !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+	if tt, ok := TokenTimeFromError(err); !ok || tt.ExpiresAt == 0 || tt.Now == 0 {
+		t.Errorf("Invalid TokenTime %v", tt)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	tests := []error{
+		nil,
+		errors.New("other"),
+		rpc.ServerError("not json"),
+		rpc.ServerError(jsonrpc2.NewError(100, "OTHER").Error()),
+	}
+	for _, err := range tests {
+		if e := clientError(err); e != err {
+			t.Errorf("Error %v should be returned as is, got %v", err, e)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+module github.com/qarea/ctxtg
+
+go 1.21
+
+require (
+	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/powerman/rpc-codec v1.2.2
+)
@@ -0,0 +1,229 @@
+package ctxtg
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP headers used to transfer Context fields
+const (
+	TokenHeader        = "X-Ctxtg-Token"
+	DeadlineHeader     = "X-Ctxtg-Deadline"
+	DeadlineNanoHeader = "X-Ctxtg-Deadline-Nano"
+	BudgetHeader       = "X-Ctxtg-Budget"
+	TracingIDHeader    = "X-Ctxtg-Tracing-Id"
+	DataHeader         = "X-Ctxtg-Data"
+)
+
+// MaxDataHeaderSize is max length of single encoded Data entry
+const MaxDataHeaderSize = 4096
+
+// Types of Data values supported by header codec
+const (
+	dataTypeNull     = "null"
+	dataTypeString   = "string"
+	dataTypeBool     = "bool"
+	dataTypeInt      = "int"
+	dataTypeInt64    = "int64"
+	dataTypeFloat64  = "float64"
+	dataTypeDuration = "duration"
+	dataTypeJSON     = "json"
+)
+
+// Errors for header codec
+var (
+	ErrHeaderMalformed       = errors.New("ctxtg: malformed header")
+	ErrHeaderDataTooLarge    = errors.New("ctxtg: Data entry is too large for header")
+	ErrHeaderDataUnsupported = errors.New("ctxtg: Data value can't be JSON encoded for header")
+)
+
+// EncodeHeader writes all non-empty fields of c to h.
+// Each Data entry is written as separate DataHeader value in form key=type:value,
+// where key and value are URL query escaped.
+// Values of type string, bool, int, int64, float64, time.Duration and nil keep their type,
+// other values are JSON encoded and decoded like Context sent with jsonrpc2 (see TypedKey).
+// Data is checked with DefaultDataLimits, reserved keys are not allowed.
+func EncodeHeader(h http.Header, c Context) error {
+	return DefaultDataLimits().EncodeHeader(h, c)
+}
+
+// EncodeHeader works like EncodeHeader function but checks Data with l
+func (l DataLimits) EncodeHeader(h http.Header, c Context) error {
+	entries := make([]string, 0, len(c.Data))
+	for k, v := range c.Data {
+		entry, err := encodeDataEntry(k, v)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+	}
+	if err := l.checkOutgoing(c.Data); err != nil {
+		return err
+	}
+	h.Del(TokenHeader)
+	h.Del(DeadlineHeader)
+	h.Del(DeadlineNanoHeader)
+	h.Del(BudgetHeader)
+	h.Del(TracingIDHeader)
+	h.Del(DataHeader)
+	if c.Token != "" {
+		h.Set(TokenHeader, string(c.Token))
+	}
+	if c.Deadline != 0 {
+		h.Set(DeadlineHeader, strconv.FormatInt(c.Deadline, 10))
+	}
+	if c.DeadlineNano != 0 {
+		h.Set(DeadlineNanoHeader, strconv.FormatInt(c.DeadlineNano, 10))
+	}
+	if c.Budget != 0 {
+		h.Set(BudgetHeader, strconv.FormatInt(int64(c.Budget), 10))
+	}
+	if c.TracingID != "" {
+		h.Set(TracingIDHeader, c.TracingID)
+	}
+	for _, entry := range entries {
+		h.Add(DataHeader, entry)
+	}
+	return nil
+}
+
+// DecodeHeader reads Context from h, written by EncodeHeader.
+// Data is checked with DefaultDataLimits, reserved keys are dropped.
+func DecodeHeader(h http.Header) (Context, error) {
+	return DefaultDataLimits().DecodeHeader(h)
+}
+
+// DecodeHeader works like DecodeHeader function but checks Data with l
+func (l DataLimits) DecodeHeader(h http.Header) (Context, error) {
+	c := Context{
+		Token:     Token(h.Get(TokenHeader)),
+		TracingID: h.Get(TracingIDHeader),
+	}
+	var err error
+	if c.Deadline, err = int64Header(h, DeadlineHeader); err != nil {
+		return Context{}, err
+	}
+	if c.DeadlineNano, err = int64Header(h, DeadlineNanoHeader); err != nil {
+		return Context{}, err
+	}
+	budget, err := int64Header(h, BudgetHeader)
+	if err != nil {
+		return Context{}, err
+	}
+	c.Budget = time.Duration(budget)
+	for _, entry := range h[http.CanonicalHeaderKey(DataHeader)] {
+		k, v, err := decodeDataEntry(entry)
+		if err != nil {
+			return Context{}, err
+		}
+		if c.Data == nil {
+			c.Data = make(map[string]interface{})
+		}
+		c.Data[k] = v
+	}
+	l.dropReserved(c.Data)
+	if err := l.Check(c.Data); err != nil {
+		return Context{}, err
+	}
+	return c, nil
+}
+
+func int64Header(h http.Header, key string) (int64, error) {
+	v := h.Get(key)
+	if v == "" {
+		return 0, nil
+	}
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, ErrHeaderMalformed
+	}
+	return i, nil
+}
+
+func encodeDataEntry(k string, v interface{}) (string, error) {
+	var t, s string
+	switch v := v.(type) {
+	case nil:
+		t = dataTypeNull
+	case string:
+		t, s = dataTypeString, v
+	case bool:
+		t, s = dataTypeBool, strconv.FormatBool(v)
+	case int:
+		t, s = dataTypeInt, strconv.Itoa(v)
+	case int64:
+		t, s = dataTypeInt64, strconv.FormatInt(v, 10)
+	case float64:
+		t, s = dataTypeFloat64, strconv.FormatFloat(v, 'g', -1, 64)
+	case time.Duration:
+		t, s = dataTypeDuration, strconv.FormatInt(int64(v), 10)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return "", ErrHeaderDataUnsupported
+		}
+		t, s = dataTypeJSON, string(b)
+	}
+	entry := url.QueryEscape(k) + "=" + t + ":" + url.QueryEscape(s)
+	if len(entry) > MaxDataHeaderSize {
+		return "", ErrHeaderDataTooLarge
+	}
+	return entry, nil
+}
+
+func decodeDataEntry(entry string) (string, interface{}, error) {
+	if len(entry) > MaxDataHeaderSize {
+		return "", nil, ErrHeaderDataTooLarge
+	}
+	i := strings.IndexByte(entry, '=')
+	if i < 0 {
+		return "", nil, ErrHeaderMalformed
+	}
+	j := strings.IndexByte(entry[i:], ':')
+	if j < 0 {
+		return "", nil, ErrHeaderMalformed
+	}
+	k, err := url.QueryUnescape(entry[:i])
+	if err != nil {
+		return "", nil, ErrHeaderMalformed
+	}
+	s, err := url.QueryUnescape(entry[i+j+1:])
+	if err != nil {
+		return "", nil, ErrHeaderMalformed
+	}
+	v, err := decodeDataValue(entry[i+1:i+j], s)
+	if err != nil {
+		return "", nil, ErrHeaderMalformed
+	}
+	return k, v, nil
+}
+
+func decodeDataValue(t, s string) (interface{}, error) {
+	switch t {
+	case dataTypeNull:
+		return nil, nil
+	case dataTypeString:
+		return s, nil
+	case dataTypeBool:
+		return strconv.ParseBool(s)
+	case dataTypeInt:
+		return strconv.Atoi(s)
+	case dataTypeInt64:
+		return strconv.ParseInt(s, 10, 64)
+	case dataTypeFloat64:
+		return strconv.ParseFloat(s, 64)
+	case dataTypeDuration:
+		d, err := strconv.ParseInt(s, 10, 64)
+		return time.Duration(d), err
+	case dataTypeJSON:
+		var v interface{}
+		err := json.Unmarshal([]byte(s), &v)
+		return v, err
+	}
+	return nil, ErrHeaderDataUnsupported
+}
@@ -0,0 +1,207 @@
+package ctxtg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHeaderFromToContext(t *testing.T) {
+	deadline := time.Now().Add(10 * time.Second).Unix()
+	data := map[string]interface{}{
+		"1":            123,
+		"2":            "string with spaces, = and :",
+		"3":            3 * time.Second,
+		"key with = :": int64(-5),
+		"5":            1.5,
+		"6":            true,
+		"7":            nil,
+		"8":            []interface{}{"a", 1.0},
+		"9":            map[string]interface{}{"a": false},
+	}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, TokenKey, Token("tokentest"))
+	ctx = context.WithValue(ctx, TracingIDKey, "123123")
+	ctx = context.WithValue(ctx, DataKey, data)
+	ctx, cancel := context.WithDeadline(ctx, time.Unix(deadline, 0))
+	defer cancel()
+
+	c := FromContext(ctx)
+	h := make(http.Header)
+	if err := EncodeHeader(h, c); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	c2, err := DecodeHeader(h)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	ctx2, cancel2 := c2.ToContext()
+	defer cancel2()
+
+	if c3 := FromContext(ctx2); !reflect.DeepEqual(c, c3) {
+		t.Errorf("Should be the same %v != %v", c, c3)
+	}
+}
+
+func TestHeaderBudget(t *testing.T) {
+	c := Context{
+		Deadline: 1,
+		Budget:   3 * time.Second,
+	}
+	h := make(http.Header)
+	if err := EncodeHeader(h, c); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	c2, err := DecodeHeader(h)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(c, c2) {
+		t.Errorf("Should be the same %v != %v", c, c2)
+	}
+}
+
+func TestHeaderDataJSON(t *testing.T) {
+	type ID uint
+	now := time.Now()
+	c := Context{
+		Data: map[string]interface{}{
+			"uint":   ID(5),
+			"int32":  int32(-3),
+			"time":   now,
+			"slice":  []string{"a", "b"},
+			"struct": struct{ A int }{1},
+		},
+	}
+	h := make(http.Header)
+	if err := EncodeHeader(h, c); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	c2, err := DecodeHeader(h)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	want := map[string]interface{}{
+		"uint":   5.0,
+		"int32":  -3.0,
+		"time":   now.Format(time.RFC3339Nano),
+		"slice":  []interface{}{"a", "b"},
+		"struct": map[string]interface{}{"A": 1.0},
+	}
+	if !reflect.DeepEqual(c2.Data, want) {
+		t.Errorf("Invalid data %v", c2.Data)
+	}
+}
+
+func TestEmptyHeader(t *testing.T) {
+	h := make(http.Header)
+	if err := EncodeHeader(h, Context{}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(h) != 0 {
+		t.Errorf("Header should be empty %v", h)
+	}
+	c, err := DecodeHeader(h)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(c, Context{}) {
+		t.Errorf("Context should be empty %v", c)
+	}
+}
+
+func TestEncodeHeaderReplacesOldValues(t *testing.T) {
+	h := make(http.Header)
+	h.Set(TokenHeader, "old")
+	h.Add(DataHeader, "old=string:old")
+	if err := EncodeHeader(h, Context{Data: map[string]interface{}{"k": "v"}}); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if h.Get(TokenHeader) != "" {
+		t.Errorf("Invalid token %v", h.Get(TokenHeader))
+	}
+	if d := h[DataHeader]; len(d) != 1 {
+		t.Errorf("Invalid data %v", d)
+	}
+}
+
+func TestEncodeHeaderUnsupportedData(t *testing.T) {
+	c := Context{
+		Data: map[string]interface{}{"k": make(chan int)},
+	}
+	if err := EncodeHeader(make(http.Header), c); err != ErrHeaderDataUnsupported {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestEncodeHeaderDataTooLarge(t *testing.T) {
+	c := Context{
+		Data: map[string]interface{}{"k": strings.Repeat("a", MaxDataHeaderSize)},
+	}
+	if err := EncodeHeader(make(http.Header), c); err != ErrHeaderDataTooLarge {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestHeaderDataLimits(t *testing.T) {
+	data := make(map[string]interface{})
+	h := make(http.Header)
+	for i := 0; i <= DefaultDataLimits().MaxKeys; i++ {
+		k := strconv.Itoa(i)
+		data[k] = i
+		h.Add(DataHeader, k+"=int:1")
+	}
+	if err := EncodeHeader(make(http.Header), Context{Data: data}); !errors.Is(err, ErrDataTooManyKeys) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := DecodeHeader(h); !errors.Is(err, ErrDataTooManyKeys) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestHeaderDataReserved(t *testing.T) {
+	c := Context{Data: map[string]interface{}{ReservedDataPrefix + "k": 1}}
+	if err := EncodeHeader(make(http.Header), c); !errors.Is(err, ErrDataKeyReserved) {
+		t.Errorf("Unexpected error %v", err)
+	}
+	h := make(http.Header)
+	h.Add(DataHeader, ReservedDataPrefix+"k=int:1")
+	h.Add(DataHeader, "k=int:2")
+	c, err := DecodeHeader(h)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(c.Data, map[string]interface{}{"k": 2}) {
+		t.Errorf("Reserved keys should be dropped %v", c.Data)
+	}
+}
+
+func TestDecodeHeaderErr(t *testing.T) {
+	tests := []struct {
+		header string
+		value  string
+		err    error
+	}{
+		{DeadlineHeader, "abc", ErrHeaderMalformed},
+		{DeadlineNanoHeader, "abc", ErrHeaderMalformed},
+		{BudgetHeader, "abc", ErrHeaderMalformed},
+		{DataHeader, "novalue", ErrHeaderMalformed},
+		{DataHeader, "k=notype", ErrHeaderMalformed},
+		{DataHeader, "k=int:abc", ErrHeaderMalformed},
+		{DataHeader, "k=unknown:abc", ErrHeaderMalformed},
+		{DataHeader, "k%zz=string:abc", ErrHeaderMalformed},
+		{DataHeader, "k=string:" + strings.Repeat("a", MaxDataHeaderSize), ErrHeaderDataTooLarge},
+	}
+	for _, test := range tests {
+		h := make(http.Header)
+		h.Set(test.header, test.value)
+		if _, err := DecodeHeader(h); err != test.err {
+			t.Errorf("Unexpected error %v for %v: %v", err, test.header, test.value)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package ctxtg
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+// ClaimsHandlerFunc is http handler in which request with converted context.Context and JWT Claims will be passed if JWT Token is fine
+type ClaimsHandlerFunc func(http.ResponseWriter, *http.Request, Claims)
+
+// NewHTTPHandler returns HTTPHandler which parses Token with p and calls h
+func NewHTTPHandler(p TokenParser, h ClaimsHandlerFunc) *HTTPHandler {
+	return &HTTPHandler{
+		parser:  p,
+		handler: h,
+	}
+}
+
+// HTTPHandler is http.Handler which reads Context from request headers (see DecodeHeader),
+// parses its Token and calls handler with converted context.Context and JWT Claims.
+// Converted context.Context is derived from request context.Context, so it keeps its values
+// and is canceled when request context.Context is done.
+// Token errors are written as JSON encoded jsonrpc2 errors with status returned by HTTPStatus,
+// other errors are written as status text only, so internal error details aren't leaked.
+type HTTPHandler struct {
+	// Limits are used to check Data, DefaultDataLimits if nil
+	Limits *DataLimits
+
+	parser  TokenParser
+	handler ClaimsHandlerFunc
+}
+
+// ServeHTTP implements http.Handler
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c, err := limitsOrDefault(h.Limits).DecodeHeader(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = h.parser.ParseWithClaims(c.Token, func(claims Claims) error {
+		ctx, cancel := c.toContext(r.Context())
+		defer cancel()
+		h.handler(w, r.WithContext(ctx), claims)
+		return nil
+	})
+	if err != nil {
+		writeHTTPError(w, err)
+	}
+}
+
+func writeHTTPError(w http.ResponseWriter, err error) {
+	status := HTTPStatus(err)
+	var e *jsonrpc2.Error
+	if !errors.As(err, &e) {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write([]byte(e.Error()))
+}
+
+// Transport is http.RoundTripper which writes Context converted from request context.Context
+// to outgoing request headers (see EncodeHeader).
+// Requests with already done context.Context are not sent.
+// Token isn't sent on redirects to other hosts, like net/http doesn't forward Authorization header.
+type Transport struct {
+	// Base is used to send requests, http.DefaultTransport is used if nil
+	Base http.RoundTripper
+	// Budget enables sending time left until deadline, see FromContextWithBudget
+	Budget bool
+	// Source is used to get Token instead of request context.Context if not nil
+	Source TokenSource
+	// Limits are used to check Data, DefaultDataLimits if nil
+	Limits *DataLimits
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	ctx := r.Context()
+	c, err := outgoingContext(ctx, t.Budget, t.Source)
+	if err == nil {
+		if redirectedToOtherHost(r) {
+			c.Token = ""
+		}
+		r2 := r.Clone(ctx)
+		if err = limitsOrDefault(t.Limits).EncodeHeader(r2.Header, c); err == nil {
+			return t.base().RoundTrip(r2)
+		}
+	}
+	if r.Body != nil {
+		_ = r.Body.Close()
+	}
+	return nil, err
+}
+
+// redirectedToOtherHost reports whether r is a redirect from request to other host
+func redirectedToOtherHost(r *http.Request) bool {
+	orig := r
+	for orig.Response != nil && orig.Response.Request != nil {
+		orig = orig.Response.Request
+	}
+	return !strings.EqualFold(orig.URL.Host, r.URL.Host)
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+	return http.DefaultTransport
+}
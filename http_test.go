@@ -0,0 +1,346 @@
+package ctxtg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	c := jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, c))
+	contexttg := Context{
+		Token:     token,
+		Deadline:  time.Now().Add(10 * time.Second).Unix(),
+		TracingID: "123",
+		Data:      map[string]interface{}{"k": "v"},
+	}
+	called := false
+	h := NewHTTPHandler(testRSATokenParser(t), func(w http.ResponseWriter, r *http.Request, claims Claims) {
+		called = true
+		if claims.UserID != 3 {
+			t.Errorf("Invalid claims %v", claims)
+		}
+		if c := FromContext(r.Context()); c.Token != contexttg.Token || c.Deadline != contexttg.Deadline ||
+			c.TracingID != contexttg.TracingID || c.Data["k"] != "v" {
+			t.Errorf("Invalid context passed %v", c)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if err := EncodeHeader(r.Header, contexttg); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if !called {
+		t.Error("Handler should be called")
+	}
+	if w.Code != http.StatusTeapot {
+		t.Errorf("Unexpected status %v", w.Code)
+	}
+}
+
+func TestHTTPHandlerRequestCanceled(t *testing.T) {
+	c := jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, c))
+	h := NewHTTPHandler(testRSATokenParser(t), func(w http.ResponseWriter, r *http.Request, claims Claims) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+			t.Error("Context should be canceled")
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	r.Header.Set(TokenHeader, string(token))
+	h.ServeHTTP(httptest.NewRecorder(), r)
+}
+
+func TestHTTPHandlerParentContext(t *testing.T) {
+	type outerKey struct{}
+	c := jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, c))
+	deadline := time.Now().Add(time.Hour)
+	called := false
+	h := NewHTTPHandler(testRSATokenParser(t), func(w http.ResponseWriter, r *http.Request, claims Claims) {
+		called = true
+		if v := r.Context().Value(outerKey{}); v != "outer" {
+			t.Errorf("Value from outer middleware should be kept, got %v", v)
+		}
+		if c := FromContext(r.Context()); c.Token != token || c.TracingID != "123" {
+			t.Errorf("Invalid context passed %v", c)
+		}
+		if d, ok := r.Context().Deadline(); !ok || d.After(deadline) {
+			t.Errorf("Deadline from request context should be kept %v", d)
+		}
+	})
+
+	ctx := context.WithValue(context.Background(), outerKey{}, "outer")
+	ctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if err := EncodeHeader(r.Header, Context{Token: token, TracingID: "123"}); err != nil {
+		t.Fatal(err)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !called {
+		t.Error("Handler should be called")
+	}
+}
+
+func TestHTTPHandlerErr(t *testing.T) {
+	expired := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(-5 * time.Second).Unix(),
+	}))
+	unissued := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}))
+	p, err := NewRSATokenParser(publicRSA, RequireIssuer("auth"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		header string
+		value  string
+		status int
+		err    *jsonrpc2.Error
+	}{
+		{TokenHeader, "invalid", http.StatusUnauthorized, ErrInvalidToken},
+		{TokenHeader, string(expired), http.StatusUnauthorized, ErrTokenExpired},
+		{TokenHeader, string(unissued), http.StatusUnauthorized, ErrInvalidIssuer},
+		{DeadlineHeader, "invalid", http.StatusBadRequest, nil},
+	}
+	h := NewHTTPHandler(p, func(http.ResponseWriter, *http.Request, Claims) {
+		t.Error("Should not be called")
+	})
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(test.header, test.value)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.status {
+			t.Errorf("Unexpected status %v for %v", w.Code, test.value)
+		}
+		if test.err == nil {
+			continue
+		}
+		var e jsonrpc2.Error
+		if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		if e.Code != test.err.Code {
+			t.Errorf("Unexpected error %v", e)
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Error("WWW-Authenticate header expected")
+		}
+	}
+}
+
+func TestHTTPHandlerForbidden(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeHTTPError(w, jsonrpc2.NewError(100, "OTHER"))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Unexpected status %v", w.Code)
+	}
+}
+
+func TestHTTPHandlerInternalErr(t *testing.T) {
+	w := httptest.NewRecorder()
+	writeHTTPError(w, errors.New("i/o timeout"))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Unexpected status %v", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "timeout") {
+		t.Errorf("Error details should not be written %v", w.Body)
+	}
+}
+
+func TestTransport(t *testing.T) {
+	deadline := time.Now().Add(10 * time.Second).Unix()
+	var got Context
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		got, err = DecodeHeader(r.Header)
+		if err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, TokenKey, Token("tokentest"))
+	ctx = context.WithValue(ctx, TracingIDKey, "123123")
+	ctx = WithDataValue(ctx, "k", 1)
+	ctx, cancel := context.WithDeadline(ctx, time.Unix(deadline, 0))
+	defer cancel()
+
+	r, err := http.NewRequest("GET", srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = r.WithContext(ctx)
+	client := &http.Client{Transport: &Transport{}}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	_ = resp.Body.Close()
+	if want := FromContext(ctx); !reflect.DeepEqual(got, want) {
+		t.Errorf("Should be the same %v != %v", got, want)
+	}
+	if len(r.Header) != 0 {
+		t.Errorf("Original request should not be modified %v", r.Header)
+	}
+}
+
+func TestTransportBudget(t *testing.T) {
+	var budget string
+	tr := &Transport{
+		Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			budget = r.Header.Get(BudgetHeader)
+			return nil, nil
+		}),
+		Budget: true,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if _, err := tr.RoundTrip(r); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if budget == "" {
+		t.Error("Budget should be sent")
+	}
+}
+
+func TestTransportDeadlineExceeded(t *testing.T) {
+	called := false
+	tr := &Transport{
+		Base: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			called = true
+			return nil, nil
+		}),
+	}
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if _, err := tr.RoundTrip(r); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if called {
+		t.Error("Request should not be sent")
+	}
+}
+
+func TestTransportEncodeErr(t *testing.T) {
+	tr := &Transport{
+		Base: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			t.Error("Request should not be sent")
+			return nil, nil
+		}),
+	}
+	ctx := WithDataValue(context.Background(), "k", make(chan int))
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if _, err := tr.RoundTrip(r); err != ErrHeaderDataUnsupported {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestTransportRedirect(t *testing.T) {
+	tokens := make(map[string]string)
+	redirects := map[string]string{
+		"a/":     "http://A/same",
+		"A/same": "http://b/other",
+	}
+	client := &http.Client{Transport: &Transport{
+		Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			url := r.URL.Host + r.URL.Path
+			tokens[url] = r.Header.Get(TokenHeader)
+			resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: r}
+			if location, ok := redirects[url]; ok {
+				resp.StatusCode = http.StatusFound
+				resp.Header.Set("Location", location)
+			}
+			return resp, nil
+		}),
+	}}
+	ctx := context.WithValue(context.Background(), TokenKey, Token("secret"))
+	r, err := http.NewRequestWithContext(ctx, "GET", "http://a/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	want := map[string]string{
+		"a/":      "secret",
+		"A/same":  "secret",
+		"b/other": "",
+	}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Token should not be sent to other host %v", tokens)
+	}
+}
+
+func TestHTTPLimits(t *testing.T) {
+	l := &DataLimits{MaxKeys: 1}
+	ctx := WithDataValue(WithDataValue(context.Background(), "a", 1), "b", 2)
+	tr := &Transport{
+		Base: roundTripFunc(func(*http.Request) (*http.Response, error) {
+			t.Error("Request should not be sent")
+			return nil, nil
+		}),
+		Limits: l,
+	}
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if _, err := tr.RoundTrip(r); !errors.Is(err, ErrDataTooManyKeys) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	h := NewHTTPHandler(testRSATokenParser(t), func(http.ResponseWriter, *http.Request, Claims) {
+		t.Error("Should not be called")
+	})
+	h.Limits = l
+	r = httptest.NewRequest("GET", "/", nil)
+	if err := EncodeHeader(r.Header, FromContext(ctx)); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Unexpected status %v", w.Code)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
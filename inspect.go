@@ -0,0 +1,48 @@
+package ctxtg
+
+import (
+	"time"
+)
+
+// TokenInspector is implemented by TokenParsers which can return TokenInfo
+type TokenInspector interface {
+	Inspect(Token) (*TokenInfo, error)
+}
+
+// TokenInfo is metadata of validated JWT token
+type TokenInfo struct {
+	Claims Claims `json:"claims"`
+	// Header is JOSE header of token
+	Header    map[string]interface{} `json:"header"`
+	Algorithm string                 `json:"alg"`
+	KeyID     string                 `json:"kid,omitempty"`
+	Issuer    string                 `json:"iss,omitempty"`
+	Audience  []string               `json:"aud,omitempty"`
+	// ExpiresAt is zero if token doesn't expire
+	ExpiresAt time.Time `json:"exp"`
+	// ExpiresIn is time left until expiry by parser clock, zero if token doesn't expire
+	ExpiresIn time.Duration `json:"expires_in"`
+}
+
+// Inspect parses and validates JWT token like Parse and returns its TokenInfo
+func (p *jwtParser) Inspect(t Token) (*TokenInfo, error) {
+	c, token, err := p.parse(t)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(*jwtClaims)
+	kid, _ := token.Header["kid"].(string)
+	info := &TokenInfo{
+		Claims:    *c,
+		Header:    token.Header,
+		Algorithm: token.Method.Alg(),
+		KeyID:     kid,
+		Issuer:    claims.Issuer,
+		Audience:  claims.Audience,
+		ExpiresAt: unixTime(claims.ExpiresAt),
+	}
+	if !info.ExpiresAt.IsZero() {
+		info.ExpiresIn = info.ExpiresAt.Sub(p.timeNow())
+	}
+	return info, nil
+}
@@ -0,0 +1,64 @@
+package ctxtg
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestInspect(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	s, err := NewECDSATokenSigner(privateES256, WithKeyID("ec"), WithIssuer("auth"), WithAudience("tracker"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3, SessionID: "s1"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p TokenInspector = testKeySetTokenParser(t)
+	info, err := p.Inspect(token)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if info.Claims.UserID != 3 || info.Claims.SessionID != "s1" || info.Claims.TokenID == "" {
+		t.Errorf("Invalid claims %v", info.Claims)
+	}
+	if info.Algorithm != "ES256" || info.KeyID != "ec" || info.Header["typ"] != "JWT" {
+		t.Errorf("Invalid header %v", info)
+	}
+	if info.Issuer != "auth" || !reflect.DeepEqual(info.Audience, []string{"tracker"}) {
+		t.Errorf("Invalid issuer or audience %v %v", info.Issuer, info.Audience)
+	}
+	expiresAt := time.Unix(now.Add(time.Minute).Unix(), 0)
+	if !info.ExpiresAt.Equal(expiresAt) || info.ExpiresIn != expiresAt.Sub(now) {
+		t.Errorf("Invalid expiry %v %v", info.ExpiresAt, info.ExpiresIn)
+	}
+}
+
+func TestInspectWithoutExpiry(t *testing.T) {
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject: "3",
+	}))
+	info, err := testRSATokenParser(t).Inspect(token)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !info.ExpiresAt.IsZero() || info.ExpiresIn != 0 || info.KeyID != "" {
+		t.Errorf("Invalid info %v", info)
+	}
+}
+
+func TestInspectErr(t *testing.T) {
+	expired := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(-5 * time.Second).Unix(),
+	}))
+	if info, err := testRSATokenParser(t).Inspect(expired); !errors.Is(err, ErrTokenExpired) || info != nil {
+		t.Errorf("Expected ErrTokenExpired, got %v %v", info, err)
+	}
+}
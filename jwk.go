@@ -0,0 +1,216 @@
+package ctxtg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"sync"
+)
+
+// Errors for JWKS handling
+var (
+	// ErrInvalidJWK returned for JSON Web Keys with invalid or unsupported parameters
+	ErrInvalidJWK = errors.New("ctxtg: invalid JWK")
+	// ErrInvalidKeyID returned when published signer has empty or duplicate key id
+	ErrInvalidKeyID = errors.New("ctxtg: empty or duplicate key id")
+)
+
+// PublicKeySigner is TokenSigner which public key can be published in JWKS document.
+// Implemented by RSATokenSigner, ECDSATokenSigner and Ed25519TokenSigner
+type PublicKeySigner interface {
+	TokenSigner
+	KeyID() string
+	Alg() string
+	PublicKey() crypto.PublicKey
+}
+
+// NewJWKS returns JWKS document with public keys of signers.
+// Every signer must have unique non-empty key id, see WithKeyID.
+func NewJWKS(signers ...PublicKeySigner) (JWKS, error) {
+	set := JWKS{
+		Keys: make([]JWK, 0, len(signers)),
+	}
+	kids := make(map[string]bool, len(signers))
+	for _, s := range signers {
+		kid := s.KeyID()
+		if kid == "" || kids[kid] {
+			return JWKS{}, ErrInvalidKeyID
+		}
+		kids[kid] = true
+		k, err := newJWK(kid, s.PublicKey())
+		if err != nil {
+			return JWKS{}, err
+		}
+		k.Alg = s.Alg()
+		set.Keys = append(set.Keys, k)
+	}
+	return set, nil
+}
+
+// NewJWKSHandler returns JWKSHandler publishing public keys of signers, see NewJWKS
+func NewJWKSHandler(signers ...PublicKeySigner) (*JWKSHandler, error) {
+	h := &JWKSHandler{}
+	if err := h.SetSigners(signers...); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// JWKSHandler is http.Handler serving JWKS document for JWKSTokenParser.
+// To rotate keys publish new signer along with current one before switching to it
+// and keep old one published until tokens signed with it expire.
+type JWKSHandler struct {
+	mu   sync.RWMutex
+	body []byte
+}
+
+// SetSigners replaces published keys with public keys of signers, see NewJWKS.
+// Published keys are not changed on error.
+func (h *JWKSHandler) SetSigners(signers ...PublicKeySigner) error {
+	set, err := NewJWKS(signers...)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		return err
+	}
+	h.mu.Lock()
+	h.body = b
+	h.mu.Unlock()
+	return nil
+}
+
+func (h *JWKSHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	h.mu.RLock()
+	b := h.body
+	h.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/jwk-set+json")
+	_, _ = w.Write(b)
+}
+
+// JWKS is JSON Web Key Set document (RFC 7517)
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is JSON Web Key (RFC 7517) with RSA, EC or OKP (Ed25519) public key
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	// RSA key parameters
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// EC and OKP key parameters
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// PublicKey returns *rsa.PublicKey, *ecdsa.PublicKey or ed25519.PublicKey described by k
+func (k JWK) PublicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := jwkInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := jwkInt(k.E)
+		if err != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, ErrInvalidJWK
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		c := jwkCurve(k.Crv)
+		if c == nil {
+			return nil, ErrInvalidJWK
+		}
+		x, err := jwkInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwkInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pk := &ecdsa.PublicKey{Curve: c, X: x, Y: y}
+		if _, err := pk.ECDH(); err != nil {
+			return nil, ErrInvalidJWK
+		}
+		return pk, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if k.Crv != "Ed25519" || err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, ErrInvalidJWK
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, ErrInvalidJWK
+}
+
+// newJWK returns JWK for RSA, ECDSA or Ed25519 public key
+func newJWK(kid string, key interface{}) (JWK, error) {
+	k := JWK{
+		Kid: kid,
+		Use: "sig",
+	}
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		k.Kty = "RSA"
+		k.N = base64.RawURLEncoding.EncodeToString(key.N.Bytes())
+		k.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+	case *ecdsa.PublicKey:
+		m, err := ecdsaSigningMethod(key.Curve)
+		if err != nil {
+			return JWK{}, err
+		}
+		size := (key.Curve.Params().BitSize + 7) / 8
+		k.Kty = "EC"
+		k.Alg = m.Alg()
+		k.Crv = key.Curve.Params().Name
+		k.X = base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, size)))
+		k.Y = base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, size)))
+	case ed25519.PublicKey:
+		k.Kty = "OKP"
+		k.Alg = SigningMethodEdDSA.Alg()
+		k.Crv = "Ed25519"
+		k.X = base64.RawURLEncoding.EncodeToString(key)
+	default:
+		return JWK{}, ErrUnsupportedKey
+	}
+	return k, nil
+}
+
+func jwkInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, ErrInvalidJWK
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func jwkCurve(crv string) elliptic.Curve {
+	switch crv {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+	return nil
+}
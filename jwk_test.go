@@ -0,0 +1,158 @@
+package ctxtg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestJWKPublicKey(t *testing.T) {
+	for _, pem := range [][]byte{publicRSA, publicES256, publicES384, publicEd25519} {
+		key, err := parsePublicKeyFromPEM(pem)
+		if err != nil {
+			t.Fatal(err)
+		}
+		jwk, err := newJWK("kid", key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(jwk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var decoded JWK
+		if err := json.Unmarshal(b, &decoded); err != nil {
+			t.Fatal(err)
+		}
+		k, err := decoded.PublicKey()
+		if err != nil {
+			t.Fatalf("Unexpected error %v for %s", err, b)
+		}
+		if !reflect.DeepEqual(k, key) {
+			t.Errorf("Invalid key %v, expected %v", k, key)
+		}
+	}
+}
+
+func TestJWKPublicKeyInvalid(t *testing.T) {
+	tests := []JWK{
+		{Kty: "oct"},
+		{Kty: "RSA", N: "!", E: "AQAB"},
+		{Kty: "RSA", N: "AQAB"},
+		{Kty: "EC", Crv: "P-224", X: "AQAB", Y: "AQAB"},
+		{Kty: "EC", Crv: "P-256", X: "AQAB", Y: "AQAB"},
+		{Kty: "OKP", Crv: "X25519", X: "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"},
+		{Kty: "OKP", Crv: "Ed25519", X: "AQAB"},
+	}
+	for _, test := range tests {
+		if k, err := test.PublicKey(); err != ErrInvalidJWK {
+			t.Errorf("Expected ErrInvalidJWK for %v, got %v %v", test, k, err)
+		}
+	}
+}
+
+func TestNewJWKS(t *testing.T) {
+	set, err := NewJWKS(testKeySetSigners(t)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	algs := map[string]string{"rsa": "RS256", "ec": "ES256", "ed": "EdDSA"}
+	if len(set.Keys) != len(algs) {
+		t.Fatalf("Invalid keys %v", set.Keys)
+	}
+	for _, k := range set.Keys {
+		if k.Alg != algs[k.Kid] || k.Use != "sig" {
+			t.Errorf("Invalid key %v", k)
+		}
+	}
+}
+
+func TestNewJWKSInvalidKeyID(t *testing.T) {
+	rsaSigner, err := NewRSATokenSigner(privateRSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWKS(rsaSigner); err != ErrInvalidKeyID {
+		t.Errorf("Expected ErrInvalidKeyID, got %v", err)
+	}
+	ecSigner, err := NewECDSATokenSigner(privateES256, WithKeyID("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSigner, err := NewEd25519TokenSigner(privateEd25519, WithKeyID("k"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWKS(ecSigner, edSigner); err != ErrInvalidKeyID {
+		t.Errorf("Expected ErrInvalidKeyID, got %v", err)
+	}
+}
+
+func TestJWKSHandler(t *testing.T) {
+	oldSigner, err := NewRSATokenSigner(privateRSA, WithKeyID("old"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSigner, err := NewECDSATokenSigner(privateES256, WithKeyID("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewJWKSHandler(oldSigner)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+	p, err := NewJWKSTokenParser(srv.URL, JWKSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	oldToken, err := oldSigner.Sign(Claims{UserID: 3}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Parse(oldToken); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	if err := h.SetSigners(newSigner, oldSigner); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.SetSigners(newSigner, newSigner); err != ErrInvalidKeyID {
+		t.Errorf("Expected ErrInvalidKeyID, got %v", err)
+	}
+	if err := p.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	newToken, err := newSigner.Sign(Claims{UserID: 3}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, token := range []Token{oldToken, newToken} {
+		if _, err := p.Parse(token); err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+}
+
+func TestJWKSHandlerMethod(t *testing.T) {
+	h, err := NewJWKSHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/jwk-set+json" || w.Body.String() != `{"keys":[]}` {
+		t.Errorf("Invalid response %v %v %q", w.Code, w.Header(), w.Body)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Invalid status %v", w.Code)
+	}
+}
@@ -0,0 +1,185 @@
+package ctxtg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Defaults for JWKSConfig
+const (
+	DefaultJWKSRefreshInterval    = time.Hour
+	DefaultJWKSMinRefreshInterval = time.Minute
+)
+
+// maxJWKSSize limits size of fetched JWKS document
+const maxJWKSSize = 1 << 20
+
+// Errors for JWKSTokenParser
+var (
+	ErrJWKSFetch  = errors.New("ctxtg: can't fetch JWKS")
+	ErrJWKSNoKeys = errors.New("ctxtg: JWKS has no usable signing keys")
+)
+
+// JWKSConfig configures JWKSTokenParser
+type JWKSConfig struct {
+	// RefreshInterval between background refreshes of keys, DefaultJWKSRefreshInterval if 0
+	RefreshInterval time.Duration
+	// MinRefreshInterval limits refreshes caused by tokens with unknown "kid", DefaultJWKSMinRefreshInterval if 0
+	MinRefreshInterval time.Duration
+	// Client is used to fetch JWKS by URL, client with 10 seconds timeout is used if nil
+	Client *http.Client
+	// OnRefreshError if not nil is called with errors of background refreshes and refreshes caused by unknown "kid".
+	// Cached keys are kept after such errors and may become stale.
+	OnRefreshError func(error)
+}
+
+// NewJWKSTokenParser fetches JWKS document from source and returns JWKSTokenParser
+// which verifies tokens with keys from it selected by "kid" header.
+// Source is either http(s) URL or path to local file (optionally prefixed with file://).
+// Keys are refreshed in background until Close is called.
+func NewJWKSTokenParser(source string, cfg JWKSConfig, opts ...ParserOption) (*JWKSTokenParser, error) {
+	if cfg.RefreshInterval <= 0 {
+		cfg.RefreshInterval = DefaultJWKSRefreshInterval
+	}
+	if cfg.MinRefreshInterval <= 0 {
+		cfg.MinRefreshInterval = DefaultJWKSMinRefreshInterval
+	}
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	p := &JWKSTokenParser{
+		source: source,
+		cfg:    cfg,
+		keys:   newKeySet(),
+		done:   make(chan struct{}),
+	}
+	p.jwtParser = newJWTParser(p.keyFuncWithRefresh, opts)
+	if err := p.Refresh(); err != nil {
+		return nil, err
+	}
+	go p.refreshLoop()
+	return p, nil
+}
+
+// JWKSTokenParser for parsing JWT tokens signed with keys published as JWKS document.
+// Implements TokenParser
+type JWKSTokenParser struct {
+	jwtParser
+	source string
+	cfg    JWKSConfig
+	keys   *keySet
+
+	refreshMu   sync.Mutex
+	lastRefresh time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Refresh fetches JWKS document and replaces cached keys.
+// Cached keys are kept if document can't be fetched or parsed or has no usable signing keys (ErrJWKSNoKeys).
+func (p *JWKSTokenParser) Refresh() error {
+	p.refreshMu.Lock()
+	defer p.refreshMu.Unlock()
+	return p.refresh()
+}
+
+// Close stops background refresh
+func (p *JWKSTokenParser) Close() error {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+	return nil
+}
+
+func (p *JWKSTokenParser) refresh() error {
+	p.lastRefresh = timeNowFunc()
+	b, err := p.fetch()
+	if err != nil {
+		return err
+	}
+	var set JWKS
+	if err := json.Unmarshal(b, &set); err != nil {
+		return err
+	}
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		k, err := jwk.PublicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = verificationKey{key: k, alg: jwk.Alg}
+	}
+	if len(keys) == 0 {
+		return ErrJWKSNoKeys
+	}
+	p.keys.replace(keys)
+	return nil
+}
+
+func (p *JWKSTokenParser) fetch() ([]byte, error) {
+	if !strings.HasPrefix(p.source, "http://") && !strings.HasPrefix(p.source, "https://") {
+		return os.ReadFile(strings.TrimPrefix(p.source, "file://"))
+	}
+	resp, err := p.cfg.Client.Get(p.source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s", ErrJWKSFetch, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// refreshUnknown refreshes keys because of unknown kid, but not more often than MinRefreshInterval
+func (p *JWKSTokenParser) refreshUnknown() {
+	p.refreshMu.Lock()
+	if timeNowFunc().Sub(p.lastRefresh) < p.cfg.MinRefreshInterval {
+		p.refreshMu.Unlock()
+		return
+	}
+	err := p.refresh()
+	p.refreshMu.Unlock()
+	p.refreshError(err)
+}
+
+func (p *JWKSTokenParser) refreshError(err error) {
+	if err != nil && p.cfg.OnRefreshError != nil {
+		p.cfg.OnRefreshError(err)
+	}
+}
+
+func (p *JWKSTokenParser) refreshLoop() {
+	t := time.NewTicker(p.cfg.RefreshInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			p.refreshError(p.Refresh())
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *JWKSTokenParser) keyFuncWithRefresh(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	now := p.timeNow()
+	if _, ok := p.keys.get(kid, now); !ok {
+		p.refreshUnknown()
+	}
+	return p.keys.keyFunc(t, now)
+}
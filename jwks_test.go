@@ -0,0 +1,265 @@
+package ctxtg
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestJWKSTokenParser(t *testing.T) {
+	srv := newTestJWKSServer(t, "rsa", "ec", "ed")
+	defer srv.Close()
+	p, err := NewJWKSTokenParser(srv.URL, JWKSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, s := range testKeySetSigners(t) {
+		token, err := s.Sign(Claims{UserID: 3}, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := p.Parse(token)
+		if err != nil {
+			t.Fatalf("Unexpected error %v for %v", err, s.KeyID())
+		}
+		if claims.UserID != 3 {
+			t.Errorf("Invalid claims %v", claims)
+		}
+	}
+}
+
+func TestJWKSTokenParserUnknownKeyID(t *testing.T) {
+	srv := newTestJWKSServer(t, "rsa")
+	defer srv.Close()
+	p, err := NewJWKSTokenParser(srv.URL, JWKSConfig{MinRefreshInterval: 5 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	s, err := NewECDSATokenSigner(privateES256, WithKeyID("ec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv.setKeys(t, "rsa", "ec")
+	if _, err := p.Parse(token); err == nil {
+		t.Error("Keys should not be refreshed more often than MinRefreshInterval")
+	}
+	if n := srv.requests(); n != 1 {
+		t.Errorf("Invalid requests count %v", n)
+	}
+
+	_, f := testTime()
+	defer f()
+	if _, err := p.Parse(token); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if _, err := p.Parse(token); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if n := srv.requests(); n != 2 {
+		t.Errorf("Invalid requests count %v", n)
+	}
+}
+
+func TestJWKSTokenParserBackgroundRefresh(t *testing.T) {
+	srv := newTestJWKSServer(t, "rsa")
+	defer srv.Close()
+	p, err := NewJWKSTokenParser(srv.URL, JWKSConfig{RefreshInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	srv.setKeys(t, "ed")
+	for i := 0; i < 100; i++ {
+		if _, ok := p.keys.get("ed", time.Now()); ok {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, ok := p.keys.get("ed", time.Now()); !ok {
+		t.Error("Keys should be refreshed")
+	}
+	if _, ok := p.keys.get("rsa", time.Now()); ok {
+		t.Error("Removed key should be dropped")
+	}
+}
+
+func TestJWKSTokenParserFile(t *testing.T) {
+	var set JWKS
+	for _, kid := range []string{"rsa", "ec", "ed"} {
+		set.Keys = append(set.Keys, testJWK(t, kid))
+	}
+	set.Keys = append(set.Keys, JWK{Kty: "oct", Kid: "unsupported"})
+	enc := testJWK(t, "ec")
+	enc.Use = "enc"
+	enc.Kid = "enc"
+	set.Keys = append(set.Keys, enc)
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, source := range []string{path, "file://" + path} {
+		p, err := NewJWKSTokenParser(source, JWKSConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Close()
+		for _, kid := range []string{"rsa", "ec", "ed"} {
+			if _, ok := p.keys.get(kid, time.Now()); !ok {
+				t.Errorf("Key %v should be loaded from %v", kid, source)
+			}
+		}
+		for _, kid := range []string{"unsupported", "enc"} {
+			if _, ok := p.keys.get(kid, time.Now()); ok {
+				t.Errorf("Key %v should be skipped", kid)
+			}
+		}
+	}
+}
+
+func TestJWKSTokenParserErr(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	if _, err := NewJWKSTokenParser(srv.URL, JWKSConfig{}); !errors.Is(err, ErrJWKSFetch) {
+		t.Errorf("Expected ErrJWKSFetch, got %v", err)
+	}
+	if _, err := NewJWKSTokenParser(filepath.Join(t.TempDir(), "missing"), JWKSConfig{}); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
+
+func TestJWKSTokenParserKeepKeysOnErr(t *testing.T) {
+	srv := newTestJWKSServer(t, "rsa")
+	defer srv.Close()
+	p, err := NewJWKSTokenParser(srv.URL, JWKSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	srv.mu.Lock()
+	srv.body = []byte("invalid")
+	srv.mu.Unlock()
+	if err := p.Refresh(); err == nil {
+		t.Error("Expected error")
+	}
+	if _, ok := p.keys.get("rsa", time.Now()); !ok {
+		t.Error("Cached keys should be kept")
+	}
+
+	for _, body := range []string{`{}`, `{"keys":[{"kty":"oct","kid":"rsa"}]}`} {
+		srv.mu.Lock()
+		srv.body = []byte(body)
+		srv.mu.Unlock()
+		if err := p.Refresh(); err != ErrJWKSNoKeys {
+			t.Errorf("Expected ErrJWKSNoKeys for %v, got %v", body, err)
+		}
+		if _, ok := p.keys.get("rsa", time.Now()); !ok {
+			t.Errorf("Cached keys should be kept for %v", body)
+		}
+	}
+}
+
+func TestJWKSTokenParserRefreshError(t *testing.T) {
+	srv := newTestJWKSServer(t, "rsa")
+	defer srv.Close()
+	errs := make(chan error, 1)
+	p, err := NewJWKSTokenParser(srv.URL, JWKSConfig{
+		RefreshInterval: 10 * time.Millisecond,
+		OnRefreshError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	srv.setKeys(t)
+	select {
+	case err := <-errs:
+		if err != ErrJWKSNoKeys {
+			t.Errorf("Expected ErrJWKSNoKeys, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("OnRefreshError should be called")
+	}
+}
+
+type testJWKSServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	body  []byte
+	count int
+}
+
+func newTestJWKSServer(t *testing.T, kids ...string) *testJWKSServer {
+	s := &testJWKSServer{}
+	s.setKeys(t, kids...)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.count++
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(s.body)
+	}))
+	return s
+}
+
+func (s *testJWKSServer) setKeys(t *testing.T, kids ...string) {
+	var set JWKS
+	for _, kid := range kids {
+		set.Keys = append(set.Keys, testJWK(t, kid))
+	}
+	b, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.mu.Lock()
+	s.body = b
+	s.mu.Unlock()
+}
+
+func (s *testJWKSServer) requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// testJWK returns JWK for one of kids used by testKeySetSigners
+func testJWK(t *testing.T, kid string) JWK {
+	keys := map[string][]byte{
+		"rsa": publicRSA,
+		"ec":  publicES256,
+		"ed":  publicEd25519,
+	}
+	k, err := parsePublicKeyFromPEM(keys[kid])
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwk, err := newJWK(kid, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwk
+}
@@ -0,0 +1,199 @@
+package ctxtg
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ErrUnsupportedKey returned for keys other than RSA, ECDSA or Ed25519 public keys
+var ErrUnsupportedKey = errors.New("ctxtg: unsupported public key type")
+
+// NewKeySetTokenParser returns KeySetTokenParser without keys, add them with AddKey
+func NewKeySetTokenParser(opts ...ParserOption) *KeySetTokenParser {
+	p := &KeySetTokenParser{
+		keys: newKeySet(),
+	}
+	p.jwtParser = newJWTParser(p.keyFunc, opts)
+	return p
+}
+
+// KeySetTokenParser for parsing JWT tokens signed with one of RSA, ECDSA or Ed25519 keys,
+// selected by token "kid" header. Tokens without "kid" are verified with key added with empty kid.
+// Keys can be added, retired and removed at any time to rotate them without downtime.
+// Implements TokenParser
+type KeySetTokenParser struct {
+	jwtParser
+	keys *keySet
+}
+
+// AddKey parses PEM encoded publicKey and adds it with kid, replacing existing key with the same kid
+func (p *KeySetTokenParser) AddKey(kid string, publicKey []byte) error {
+	k, err := parsePublicKeyFromPEM(publicKey)
+	if err != nil {
+		return err
+	}
+	p.keys.add(kid, verificationKey{key: k})
+	return nil
+}
+
+// RetireKey keeps key with kid valid only during grace period by parser clock, after that it will be removed.
+// It is used to rotate keys: add new key, switch signer to it and retire old key
+// with grace period not less than tokens timeout.
+func (p *KeySetTokenParser) RetireKey(kid string, grace time.Duration) {
+	p.keys.retire(kid, p.timeNow().Add(grace))
+}
+
+// RemoveKey removes key with kid immediately
+func (p *KeySetTokenParser) RemoveKey(kid string) {
+	p.keys.remove(kid)
+}
+
+func (p *KeySetTokenParser) keyFunc(t *jwt.Token) (interface{}, error) {
+	return p.keys.keyFunc(t, p.timeNow())
+}
+
+type verificationKey struct {
+	key interface{}
+	// alg restricts signing method if set
+	alg       string
+	expiresAt time.Time
+}
+
+func (k verificationKey) expired(now time.Time) bool {
+	return !k.expiresAt.IsZero() && !now.Before(k.expiresAt)
+}
+
+type keySet struct {
+	mu   sync.RWMutex
+	keys map[string]verificationKey
+}
+
+func newKeySet() *keySet {
+	return &keySet{
+		keys: make(map[string]verificationKey),
+	}
+}
+
+func (s *keySet) add(kid string, k verificationKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[kid] = k
+}
+
+func (s *keySet) replace(keys map[string]verificationKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func (s *keySet) retire(kid string, expiresAt time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k, ok := s.keys[kid]; ok {
+		k.expiresAt = expiresAt
+		s.keys[kid] = k
+	}
+}
+
+func (s *keySet) remove(kid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, kid)
+}
+
+// get returns key with kid, retired keys are removed if expired at now
+func (s *keySet) get(kid string, now time.Time) (verificationKey, bool) {
+	s.mu.RLock()
+	k, ok := s.keys[kid]
+	s.mu.RUnlock()
+	if ok && k.expired(now) {
+		s.mu.Lock()
+		if k, ok := s.keys[kid]; ok && k.expired(now) {
+			delete(s.keys, kid)
+		}
+		s.mu.Unlock()
+		return verificationKey{}, false
+	}
+	return k, ok
+}
+
+// keyFunc works like jwt.Keyfunc, now is parser time
+func (s *keySet) keyFunc(t *jwt.Token, now time.Time) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	k, ok := s.get(kid, now)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if k.alg != "" && k.alg != t.Method.Alg() {
+		return nil, ErrInvalidAlgorithm
+	}
+	return publicKeyFunc(k.key)(t)
+}
+
+// publicKeyFunc returns jwt.Keyfunc which returns key if token signing method matches it
+func publicKeyFunc(key interface{}) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		if !keyAllowsMethod(key, t.Method) {
+			return nil, ErrInvalidAlgorithm
+		}
+		return key, nil
+	}
+}
+
+func keyAllowsMethod(key interface{}, m jwt.SigningMethod) bool {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		_, ok := m.(*jwt.SigningMethodRSA)
+		return ok
+	case *ecdsa.PublicKey:
+		em, err := ecdsaSigningMethod(k.Curve)
+		return err == nil && m.Alg() == em.Alg()
+	case ed25519.PublicKey:
+		return m == SigningMethodEdDSA
+	}
+	return false
+}
+
+// parsePublicKeyFromPEM parses PKIX, PKCS #1 or certificate PEM block with RSA, ECDSA or Ed25519 public key
+func parsePublicKeyFromPEM(key []byte) (interface{}, error) {
+	block, _ := pem.Decode(key)
+	if block == nil {
+		return nil, jwt.ErrKeyMustBePEMEncoded
+	}
+	var (
+		k   interface{}
+		err error
+	)
+	switch block.Type {
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			k = cert.PublicKey
+		}
+	case "RSA PUBLIC KEY":
+		k, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		k, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := k.(type) {
+	case *rsa.PublicKey, ed25519.PublicKey:
+		return k, nil
+	case *ecdsa.PublicKey:
+		if _, err := ecdsaSigningMethod(k.Curve); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	return nil, ErrUnsupportedKey
+}
@@ -0,0 +1,229 @@
+package ctxtg
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func TestKeySetTokenParser(t *testing.T) {
+	p := testKeySetTokenParser(t)
+	for _, s := range testKeySetSigners(t) {
+		token, err := s.Sign(Claims{UserID: 3}, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := p.Parse(token)
+		if err != nil {
+			t.Fatalf("Unexpected error %v for %v", err, s.KeyID())
+		}
+		if claims.UserID != 3 {
+			t.Errorf("Invalid claims %v", claims)
+		}
+	}
+}
+
+func TestKeySetTokenParserKeyID(t *testing.T) {
+	s, err := NewECDSATokenSigner(privateES256, WithKeyID("ec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jt, _, err := new(jwt.Parser).ParseUnverified(string(token), &jwt.StandardClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := jt.Header["kid"]; kid != "ec" {
+		t.Errorf("Invalid kid %v", kid)
+	}
+}
+
+func TestKeySetTokenParserInvalidKeyID(t *testing.T) {
+	p := testKeySetTokenParser(t)
+	var signers []TokenSigner
+	for _, kid := range []string{"unknown", "", "ec"} {
+		s, err := NewRSATokenSigner(privateRSA, WithKeyID(kid))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, s)
+	}
+	s, err := NewECDSATokenSigner(privateES256, WithKeyID("rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	signers = append(signers, s)
+
+	for _, s := range signers {
+		token, err := s.Sign(Claims{UserID: 3}, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if claims, err := p.Parse(token); err == nil || claims != nil {
+			t.Errorf("Expected error for %v: %v %v", s, claims, err)
+		}
+	}
+}
+
+func TestKeySetTokenParserWithoutKeyID(t *testing.T) {
+	p := NewKeySetTokenParser()
+	if err := p.AddKey("", publicRSA); err != nil {
+		t.Fatal(err)
+	}
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}))
+	if _, err := p.Parse(token); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestKeySetTokenParserRetireKey(t *testing.T) {
+	p := testKeySetTokenParser(t)
+	s, err := NewRSATokenSigner(privateRSA, WithKeyID("rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RetireKey("rsa", 10*time.Second)
+	p.RetireKey("unknown", 10*time.Second)
+	if _, err := p.Parse(token); err != nil {
+		t.Errorf("Key should be valid during grace period %v", err)
+	}
+
+	_, f := testTime()
+	defer f()
+	if _, err := p.Parse(token); err == nil {
+		t.Error("Key should be expired")
+	}
+	if _, ok := p.keys.keys["rsa"]; ok {
+		t.Error("Expired key should be removed")
+	}
+}
+
+func TestKeySetTokenParserRetireKeyClock(t *testing.T) {
+	now := time.Now()
+	p := NewKeySetTokenParser(WithClock(func() time.Time { return now }))
+	if err := p.AddKey("rsa", publicRSA); err != nil {
+		t.Fatal(err)
+	}
+	s, err := NewRSATokenSigner(privateRSA, WithKeyID("rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RetireKey("rsa", 10*time.Second)
+	if _, err := p.Parse(token); err != nil {
+		t.Errorf("Key should be valid during grace period %v", err)
+	}
+	now = now.Add(11 * time.Second)
+	if _, err := p.Parse(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("Key should be expired by parser clock, got %v", err)
+	}
+}
+
+func TestKeySetTokenParserRemoveKey(t *testing.T) {
+	p := testKeySetTokenParser(t)
+	s, err := NewRSATokenSigner(privateRSA, WithKeyID("rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.RemoveKey("rsa")
+	if _, err := p.Parse(token); err == nil {
+		t.Error("Key should be removed")
+	}
+}
+
+func TestKeySetTokenParserConcurrent(t *testing.T) {
+	p := testKeySetTokenParser(t)
+	s, err := NewRSATokenSigner(privateRSA, WithKeyID("rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := p.AddKey("rsa", publicRSA); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, err := p.Parse(token); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestKeySetTokenParserAddKeyErr(t *testing.T) {
+	p := NewKeySetTokenParser()
+	tests := []struct {
+		key []byte
+		err error
+	}{
+		{[]byte("invalid"), jwt.ErrKeyMustBePEMEncoded},
+		{publicP224, ErrUnsupportedCurve},
+		{privateEd25519, nil},
+	}
+	for _, test := range tests {
+		if err := p.AddKey("k", test.key); err == nil || test.err != nil && err != test.err {
+			t.Errorf("Unexpected error %v", err)
+		}
+	}
+}
+
+func testKeySetTokenParser(t *testing.T) *KeySetTokenParser {
+	p := NewKeySetTokenParser()
+	keys := map[string][]byte{
+		"rsa": publicRSA,
+		"ec":  publicES256,
+		"ed":  publicEd25519,
+	}
+	for kid, k := range keys {
+		if err := p.AddKey(kid, k); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return p
+}
+
+func testKeySetSigners(t *testing.T) []PublicKeySigner {
+	rsaSigner, err := NewRSATokenSigner(privateRSA, WithKeyID("rsa"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecSigner, err := NewECDSATokenSigner(privateES256, WithKeyID("ec"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	edSigner, err := NewEd25519TokenSigner(privateEd25519, WithKeyID("ed"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []PublicKeySigner{rsaSigner, ecSigner, edSigner}
+}
@@ -0,0 +1,237 @@
+package ctxtg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"sync"
+	"time"
+)
+
+// Defaults for RefreshConfig
+const (
+	DefaultAccessTimeout  = 15 * time.Minute
+	DefaultRefreshTimeout = 30 * 24 * time.Hour
+)
+
+// RefreshToken is opaque long-lived token which can be exchanged for new TokenPair, see Refresher
+type RefreshToken string
+
+// TokenPair is short-lived access Token with RefreshToken for getting next pair
+type TokenPair struct {
+	AccessToken  Token        `json:"access_token"`
+	RefreshToken RefreshToken `json:"refresh_token"`
+	// AccessExpiresAt is expiration time of AccessToken
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	// RefreshExpiresAt is expiration time of RefreshToken
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+}
+
+// RefreshRecord is stored state of issued RefreshToken
+type RefreshRecord struct {
+	// ID is hash of RefreshToken, tokens themselves are not stored
+	ID string
+	// Family is id of all refresh tokens rotated from the same issued one, used as SessionID of access tokens
+	Family    string
+	Claims    Claims
+	ExpiresAt time.Time
+	// Used is set when token was exchanged
+	Used bool
+}
+
+// RefreshStore stores RefreshRecords for Refresher
+type RefreshStore interface {
+	// Save stores new record
+	Save(RefreshRecord) error
+	// Use atomically marks record with id as used and returns it as it was before,
+	// returns ErrInvalidRefreshToken if there is no such record
+	Use(id string) (RefreshRecord, error)
+	// RevokeFamily removes all records of family
+	RevokeFamily(family string) error
+}
+
+// RefreshConfig configures Refresher
+type RefreshConfig struct {
+	// AccessTimeout is timeout of access tokens, DefaultAccessTimeout if 0
+	AccessTimeout time.Duration
+	// RefreshTimeout is timeout of refresh tokens, DefaultRefreshTimeout if 0
+	RefreshTimeout time.Duration
+}
+
+// NewRefresher returns Refresher which signs access tokens with s and stores refresh tokens in store
+func NewRefresher(s TokenSigner, store RefreshStore, cfg RefreshConfig) *Refresher {
+	if cfg.AccessTimeout <= 0 {
+		cfg.AccessTimeout = DefaultAccessTimeout
+	}
+	if cfg.RefreshTimeout <= 0 {
+		cfg.RefreshTimeout = DefaultRefreshTimeout
+	}
+	return &Refresher{
+		signer: s,
+		store:  store,
+		cfg:    cfg,
+	}
+}
+
+// Refresher issues TokenPairs and exchanges refresh tokens for new pairs.
+// Each refresh token can be exchanged only once, reuse of already exchanged token
+// revokes all tokens rotated from the same issued one and returns ErrRefreshTokenReused.
+type Refresher struct {
+	signer TokenSigner
+	store  RefreshStore
+	cfg    RefreshConfig
+}
+
+// Issue returns new TokenPair for c starting new refresh token family.
+// If c.SessionID is empty it is set to family id, c.TokenID is ignored to give each access token unique id.
+func (r *Refresher) Issue(c Claims) (TokenPair, error) {
+	c.TokenID = ""
+	family, err := randomID(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if c.SessionID == "" {
+		c.SessionID = family
+	}
+	return r.issue(family, c)
+}
+
+// Exchange returns new TokenPair for rt, rt can't be exchanged again
+func (r *Refresher) Exchange(rt RefreshToken) (TokenPair, error) {
+	rec, err := r.store.Use(refreshTokenID(rt))
+	if err != nil {
+		return TokenPair{}, err
+	}
+	if rec.Used {
+		if err := r.store.RevokeFamily(rec.Family); err != nil {
+			return TokenPair{}, err
+		}
+		return TokenPair{}, ErrRefreshTokenReused
+	}
+	if !timeNowFunc().Before(rec.ExpiresAt) {
+		return TokenPair{}, ErrRefreshTokenExpired
+	}
+	return r.issue(rec.Family, rec.Claims)
+}
+
+// Revoke revokes rt with all tokens rotated from the same issued one, used on logout
+func (r *Refresher) Revoke(rt RefreshToken) error {
+	rec, err := r.store.Use(refreshTokenID(rt))
+	if err != nil {
+		return err
+	}
+	return r.store.RevokeFamily(rec.Family)
+}
+
+func (r *Refresher) issue(family string, c Claims) (TokenPair, error) {
+	now := timeNowFunc()
+	access, err := r.signer.Sign(c, r.cfg.AccessTimeout)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	secret, err := randomID(32)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	rt := RefreshToken(secret)
+	rec := RefreshRecord{
+		ID:        refreshTokenID(rt),
+		Family:    family,
+		Claims:    c,
+		ExpiresAt: now.Add(r.cfg.RefreshTimeout),
+	}
+	if err := r.store.Save(rec); err != nil {
+		return TokenPair{}, err
+	}
+	return TokenPair{
+		AccessToken:      access,
+		RefreshToken:     rt,
+		AccessExpiresAt:  now.Add(r.cfg.AccessTimeout),
+		RefreshExpiresAt: rec.ExpiresAt,
+	}, nil
+}
+
+func refreshTokenID(rt RefreshToken) string {
+	h := sha256.Sum256([]byte(rt))
+	return hex.EncodeToString(h[:])
+}
+
+// randomID returns base64 encoded size random bytes
+func randomID(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// NewMemoryRefreshStore returns empty MemoryRefreshStore
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{
+		records:  make(map[string]RefreshRecord),
+		families: make(map[string]map[string]bool),
+	}
+}
+
+// MemoryRefreshStore is in-memory RefreshStore for single instance services and tests.
+// Records are removed after expiration.
+type MemoryRefreshStore struct {
+	mu       sync.Mutex
+	records  map[string]RefreshRecord
+	families map[string]map[string]bool
+	sweptAt  time.Time
+}
+
+// Save stores new record
+func (s *MemoryRefreshStore) Save(rec RefreshRecord) error {
+	now := timeNowFunc()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.sweptAt) >= memorySweepInterval {
+		s.sweptAt = now
+		for id, r := range s.records {
+			if !now.Before(r.ExpiresAt) {
+				s.remove(r.Family, id)
+			}
+		}
+	}
+	s.records[rec.ID] = rec
+	if s.families[rec.Family] == nil {
+		s.families[rec.Family] = make(map[string]bool)
+	}
+	s.families[rec.Family][rec.ID] = true
+	return nil
+}
+
+// Use atomically marks record with id as used and returns it as it was before
+func (s *MemoryRefreshStore) Use(id string) (RefreshRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return RefreshRecord{}, ErrInvalidRefreshToken
+	}
+	used := rec
+	used.Used = true
+	s.records[id] = used
+	return rec, nil
+}
+
+// RevokeFamily removes all records of family
+func (s *MemoryRefreshStore) RevokeFamily(family string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := range s.families[family] {
+		s.remove(family, id)
+	}
+	return nil
+}
+
+func (s *MemoryRefreshStore) remove(family, id string) {
+	delete(s.records, id)
+	delete(s.families[family], id)
+	if len(s.families[family]) == 0 {
+		delete(s.families, family)
+	}
+}
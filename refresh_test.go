@@ -0,0 +1,166 @@
+package ctxtg
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRefresher(t *testing.T) {
+	r := NewRefresher(testRSATokenSigner(t), NewMemoryRefreshStore(), RefreshConfig{})
+	p := testRSATokenParser(t)
+	pair, err := r.Issue(Claims{UserID: 3, Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Parse(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.UserID != 3 || !c.HasRole("admin") || c.SessionID == "" {
+		t.Errorf("Invalid claims %v", c)
+	}
+	if pair.RefreshToken == "" || !pair.AccessExpiresAt.Before(pair.RefreshExpiresAt) {
+		t.Errorf("Invalid pair %v", pair)
+	}
+
+	next, err := r.Exchange(pair.RefreshToken)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if next.RefreshToken == pair.RefreshToken {
+		t.Error("Refresh token should be rotated")
+	}
+	nextClaims, err := p.Parse(next.AccessToken)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if nextClaims.UserID != 3 || nextClaims.SessionID != c.SessionID || nextClaims.TokenID == c.TokenID {
+		t.Errorf("Invalid claims %v", nextClaims)
+	}
+
+	other, err := r.Issue(Claims{UserID: 4, SessionID: "s1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err := p.Parse(other.AccessToken); err != nil || c.SessionID != "s1" {
+		t.Errorf("Invalid claims %v %v", c, err)
+	}
+}
+
+func TestRefresherReuse(t *testing.T) {
+	r := NewRefresher(testRSATokenSigner(t), NewMemoryRefreshStore(), RefreshConfig{})
+	pair, err := r.Issue(Claims{UserID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := r.Exchange(pair.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := r.Issue(Claims{UserID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := r.Exchange(pair.RefreshToken); err != ErrRefreshTokenReused {
+		t.Errorf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := r.Exchange(next.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("Whole family should be revoked, got %v", err)
+	}
+	if _, err := r.Exchange(other.RefreshToken); err != nil {
+		t.Errorf("Other family should not be revoked, got %v", err)
+	}
+}
+
+func TestRefresherConcurrentExchange(t *testing.T) {
+	r := NewRefresher(testRSATokenSigner(t), NewMemoryRefreshStore(), RefreshConfig{})
+	pair, err := r.Issue(Claims{UserID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		exchange int
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := r.Exchange(pair.RefreshToken); err == nil {
+				mu.Lock()
+				exchange++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if exchange != 1 {
+		t.Errorf("Refresh token exchanged %v times", exchange)
+	}
+}
+
+func TestRefresherExpired(t *testing.T) {
+	store := NewMemoryRefreshStore()
+	r := NewRefresher(testRSATokenSigner(t), store, RefreshConfig{
+		AccessTimeout:  time.Second,
+		RefreshTimeout: 5 * time.Second,
+	})
+	pair, err := r.Issue(Claims{UserID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, f := testTime()
+	defer f()
+	if _, err := r.Exchange(pair.RefreshToken); err != ErrRefreshTokenExpired {
+		t.Errorf("Expected ErrRefreshTokenExpired, got %v", err)
+	}
+
+	store.sweptAt = time.Time{}
+	if _, err := r.Issue(Claims{UserID: 4}); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.records) != 1 || len(store.families) != 1 {
+		t.Errorf("Expired records should be removed %v", store.records)
+	}
+}
+
+func TestRefresherRevoke(t *testing.T) {
+	r := NewRefresher(testRSATokenSigner(t), NewMemoryRefreshStore(), RefreshConfig{})
+	pair, err := r.Issue(Claims{UserID: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revoke(pair.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Exchange(pair.RefreshToken); err != ErrInvalidRefreshToken {
+		t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+	if err := r.Revoke("unknown"); err != ErrInvalidRefreshToken {
+		t.Errorf("Expected ErrInvalidRefreshToken, got %v", err)
+	}
+}
+
+func TestRefresherSignerErr(t *testing.T) {
+	signerErr := errors.New("signer err")
+	store := NewMemoryRefreshStore()
+	r := NewRefresher(testSignerFunc(func(Claims, time.Duration) (Token, error) {
+		return "", signerErr
+	}), store, RefreshConfig{})
+	if _, err := r.Issue(Claims{UserID: 3}); err != signerErr {
+		t.Errorf("Expected signer error, got %v", err)
+	}
+	if len(store.records) != 0 {
+		t.Error("Refresh token should not be stored")
+	}
+}
+
+type testSignerFunc func(Claims, time.Duration) (Token, error)
+
+func (f testSignerFunc) Sign(c Claims, timeout time.Duration) (Token, error) {
+	return f(c, timeout)
+}
@@ -0,0 +1,171 @@
+package ctxtg
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Errors for RevocationTokenParser
+var (
+	// ErrRevokerUnavailable is returned wrapped with Revoker error
+	ErrRevokerUnavailable = errors.New("ctxtg: can't check token revocation")
+	// ErrParserUnsupported is returned if wrapped parser doesn't support called method
+	ErrParserUnsupported = errors.New("ctxtg: method isn't supported by wrapped parser")
+)
+
+// Revoker stores ids of revoked tokens and sessions, see RevocationTokenParser
+type Revoker interface {
+	// Revoke marks id as revoked during ttl, which should be not less than tokens timeout
+	Revoke(id string, ttl time.Duration) error
+	// IsRevoked reports whether id is revoked
+	IsRevoked(id string) (bool, error)
+}
+
+// NewRevocationTokenParser returns RevocationTokenParser which parses tokens with p
+// and checks them with r
+func NewRevocationTokenParser(p TokenParser, r Revoker) *RevocationTokenParser {
+	return &RevocationTokenParser{
+		parser:  p,
+		revoker: r,
+	}
+}
+
+// RevocationTokenParser is TokenParser decorator which rejects tokens
+// with revoked TokenID ("jti" claim) or SessionID ("sid" claim) with ErrTokenRevoked.
+// Errors returned by Revoker are wrapped with ErrRevokerUnavailable.
+// Implements TokenParser, CustomClaimsParser and TokenInspector
+type RevocationTokenParser struct {
+	parser  TokenParser
+	revoker Revoker
+}
+
+// ParseCtxWithClaims takes context, parse JWT token, convert context and, if token valid, calls f with converted context and JWT Claims
+func (p *RevocationTokenParser) ParseCtxWithClaims(context Context, f CtxClaimsFunc) error {
+	c, err := p.Parse(context.Token)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.ToContext()
+	defer cancel()
+	return f(ctx, *c)
+}
+
+// ParseWithClaims takes t, parse JWT token and, if token valid, calls f with JWT Claims
+func (p *RevocationTokenParser) ParseWithClaims(t Token, f ClaimsFunc) error {
+	c, err := p.Parse(t)
+	if err != nil {
+		return err
+	}
+	return f(*c)
+}
+
+// Parse JWT token and return Claims or error
+func (p *RevocationTokenParser) Parse(t Token) (*Claims, error) {
+	c, err := p.parser.Parse(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.check(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// ParseInto parses JWT token with wrapped CustomClaimsParser and, if token valid and not revoked, fills c with its claims.
+// Returns ErrParserUnsupported if wrapped parser isn't CustomClaimsParser.
+func (p *RevocationTokenParser) ParseInto(t Token, c CustomClaims) error {
+	cp, ok := p.parser.(CustomClaimsParser)
+	if !ok {
+		return ErrParserUnsupported
+	}
+	if err := cp.ParseInto(t, c); err != nil {
+		return err
+	}
+	return p.check(c.standardClaims())
+}
+
+// Inspect inspects JWT token with wrapped TokenInspector and returns its TokenInfo if token valid and not revoked.
+// Returns ErrParserUnsupported if wrapped parser isn't TokenInspector.
+func (p *RevocationTokenParser) Inspect(t Token) (*TokenInfo, error) {
+	i, ok := p.parser.(TokenInspector)
+	if !ok {
+		return nil, ErrParserUnsupported
+	}
+	info, err := i.Inspect(t)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.check(&info.Claims); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// check returns ErrTokenRevoked if TokenID or SessionID of c is revoked
+func (p *RevocationTokenParser) check(c *Claims) error {
+	for _, id := range []string{c.TokenID, c.SessionID} {
+		if id == "" {
+			continue
+		}
+		revoked, err := p.revoker.IsRevoked(id)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrRevokerUnavailable, err)
+		}
+		if revoked {
+			return ErrTokenRevoked
+		}
+	}
+	return nil
+}
+
+// memorySweepInterval is minimal interval between removals of expired entries by in-memory stores
+const memorySweepInterval = time.Minute
+
+// NewMemoryRevoker returns empty MemoryRevoker
+func NewMemoryRevoker() *MemoryRevoker {
+	return &MemoryRevoker{
+		ids: make(map[string]time.Time),
+	}
+}
+
+// MemoryRevoker is in-memory Revoker for single instance services and tests.
+// Revoked ids are forgotten after their ttl.
+type MemoryRevoker struct {
+	mu      sync.Mutex
+	ids     map[string]time.Time
+	sweptAt time.Time
+}
+
+// Revoke marks id as revoked during ttl
+func (r *MemoryRevoker) Revoke(id string, ttl time.Duration) error {
+	now := timeNowFunc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now.Sub(r.sweptAt) >= memorySweepInterval {
+		r.sweptAt = now
+		for id, expiresAt := range r.ids {
+			if !now.Before(expiresAt) {
+				delete(r.ids, id)
+			}
+		}
+	}
+	if expiresAt := now.Add(ttl); expiresAt.After(r.ids[id]) {
+		r.ids[id] = expiresAt
+	}
+	return nil
+}
+
+// IsRevoked reports whether id is revoked
+func (r *MemoryRevoker) IsRevoked(id string) (bool, error) {
+	now := timeNowFunc()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	expiresAt, ok := r.ids[id]
+	if ok && !now.Before(expiresAt) {
+		delete(r.ids, id)
+		return false, nil
+	}
+	return ok, nil
+}
@@ -0,0 +1,233 @@
+package ctxtg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRevocationTokenParser(t *testing.T) {
+	r := NewMemoryRevoker()
+	p := NewRevocationTokenParser(testRSATokenParser(t), r)
+	s := testRSATokenSigner(t)
+	tests := []struct {
+		claims Claims
+		err    error
+	}{
+		{Claims{UserID: 3, TokenID: "t1", SessionID: "s1"}, nil},
+		{Claims{UserID: 3, TokenID: "revoked", SessionID: "s1"}, ErrTokenRevoked},
+		{Claims{UserID: 3, TokenID: "t1", SessionID: "revoked"}, ErrTokenRevoked},
+		{Claims{UserID: 3}, nil},
+	}
+	if err := r.Revoke("revoked", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		token, err := s.Sign(test.claims, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := p.Parse(token)
+		if err != test.err {
+			t.Errorf("Expected error %v for %v, got %v", test.err, test.claims, err)
+		}
+		if err == nil && (c.UserID != test.claims.UserID || c.SessionID != test.claims.SessionID) {
+			t.Errorf("Invalid claims %v", c)
+		}
+		err = p.ParseWithClaims(token, func(Claims) error { return nil })
+		if err != test.err {
+			t.Errorf("Expected error %v, got %v", test.err, err)
+		}
+		err = p.ParseCtxWithClaims(Context{Token: token}, func(context.Context, Claims) error { return nil })
+		if err != test.err {
+			t.Errorf("Expected error %v, got %v", test.err, err)
+		}
+	}
+}
+
+func TestRevocationTokenParserParseInto(t *testing.T) {
+	r := NewMemoryRevoker()
+	if err := r.Revoke("revoked", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var p CustomClaimsParser = NewRevocationTokenParser(testRSATokenParser(t), r)
+	s := testRSATokenSigner(t)
+	tests := []struct {
+		claims testCustomClaims
+		err    error
+	}{
+		{testCustomClaims{Claims: Claims{UserID: 3, TokenID: "t1"}, Plan: "pro"}, nil},
+		{testCustomClaims{Claims: Claims{UserID: 3, TokenID: "revoked"}, Plan: "pro"}, ErrTokenRevoked},
+		{testCustomClaims{Claims: Claims{UserID: 3, SessionID: "revoked"}, Plan: "pro"}, ErrTokenRevoked},
+	}
+	for _, test := range tests {
+		token, err := s.SignClaims(&test.claims, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var c testCustomClaims
+		if err := p.ParseInto(token, &c); err != test.err {
+			t.Errorf("Expected error %v for %v, got %v", test.err, test.claims, err)
+		}
+		if test.err == nil && (c.UserID != 3 || c.Plan != "pro") {
+			t.Errorf("Invalid claims %v", c)
+		}
+	}
+
+	p = NewRevocationTokenParser(struct{ TokenParser }{testRSATokenParser(t)}, r)
+	if err := p.ParseInto("token", &testCustomClaims{}); err != ErrParserUnsupported {
+		t.Errorf("Expected ErrParserUnsupported, got %v", err)
+	}
+}
+
+func TestRevocationTokenParserInspect(t *testing.T) {
+	r := NewMemoryRevoker()
+	if err := r.Revoke("revoked", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	var p TokenInspector = NewRevocationTokenParser(testRSATokenParser(t), r)
+	s := testRSATokenSigner(t)
+	tests := []struct {
+		claims Claims
+		err    error
+	}{
+		{Claims{UserID: 3, TokenID: "t1", SessionID: "s1"}, nil},
+		{Claims{UserID: 3, TokenID: "revoked"}, ErrTokenRevoked},
+		{Claims{UserID: 3, SessionID: "revoked"}, ErrTokenRevoked},
+	}
+	for _, test := range tests {
+		token, err := s.Sign(test.claims, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := p.Inspect(token)
+		if err != test.err {
+			t.Errorf("Expected error %v for %v, got %v", test.err, test.claims, err)
+		}
+		if test.err == nil && (info.Claims.UserID != 3 || info.Claims.SessionID != "s1" || info.Algorithm != "RS256") {
+			t.Errorf("Invalid info %v", info)
+		}
+		if test.err != nil && info != nil {
+			t.Errorf("Info should not be returned %v", info)
+		}
+	}
+
+	p = NewRevocationTokenParser(struct{ TokenParser }{testRSATokenParser(t)}, r)
+	if _, err := p.Inspect("token"); err != ErrParserUnsupported {
+		t.Errorf("Expected ErrParserUnsupported, got %v", err)
+	}
+}
+
+func TestRevocationTokenParserErr(t *testing.T) {
+	p := NewRevocationTokenParser(testRSATokenParser(t), NewMemoryRevoker())
+	if _, err := p.Parse("invalid"); err != ErrInvalidToken {
+		t.Errorf("Expected ErrInvalidToken, got %v", err)
+	}
+
+	revokerErr := errors.New("revoker err")
+	p = NewRevocationTokenParser(testRSATokenParser(t), testRevoker{err: revokerErr})
+	token, err := testRSATokenSigner(t).Sign(Claims{UserID: 3, TokenID: "t1"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Parse(token); !errors.Is(err, ErrRevokerUnavailable) || !errors.Is(err, revokerErr) {
+		t.Errorf("Expected wrapped revoker error, got %v", err)
+	}
+
+	h := NewHTTPHandler(p, func(http.ResponseWriter, *http.Request, Claims) {
+		t.Error("Should not be called")
+	})
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(TokenHeader, string(token))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected status %v", w.Code)
+	}
+	if strings.Contains(w.Body.String(), revokerErr.Error()) {
+		t.Errorf("Revoker error should not be written %v", w.Body)
+	}
+}
+
+func TestRevocationTokenParserRPCErr(t *testing.T) {
+	revokerErr := errors.New("dial tcp 10.0.0.1:6379: i/o timeout")
+	p := NewRevocationTokenParser(testRSATokenParser(t), testRevoker{err: revokerErr})
+	jsonClient := testRPCClient(t, &RPCTestService{parser: p})
+	defer jsonClient.Close()
+	token, err := testRSATokenSigner(t).Sign(Claims{UserID: 3, TokenID: "t1"}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.WithValue(context.Background(), TokenKey, token)
+	var reply int
+	err = NewRPCClient(jsonClient).Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply)
+	if err != ErrTokenCheckUnavailable {
+		t.Errorf("Expected ErrTokenCheckUnavailable, got %v", err)
+	}
+	err = jsonClient.Call("Test.Sum", &RPCTestArgs{Context: Context{Token: token}}, &reply)
+	if err == nil || strings.Contains(err.Error(), revokerErr.Error()) {
+		t.Errorf("Revoker error should not be sent %v", err)
+	}
+}
+
+func TestMemoryRevokerTTL(t *testing.T) {
+	r := NewMemoryRevoker()
+	if err := r.Revoke("short", 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revoke("long", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Revoke("long", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"short", "long"} {
+		if revoked, err := r.IsRevoked(id); err != nil || !revoked {
+			t.Errorf("%v should be revoked", id)
+		}
+	}
+
+	_, f := testTime()
+	defer f()
+	if revoked, _ := r.IsRevoked("short"); revoked {
+		t.Error("Revocation should expire")
+	}
+	if revoked, _ := r.IsRevoked("long"); !revoked {
+		t.Error("Revocation should not be shortened")
+	}
+	if revoked, _ := r.IsRevoked("unknown"); revoked {
+		t.Error("Unknown id should not be revoked")
+	}
+}
+
+func TestMemoryRevokerSweep(t *testing.T) {
+	r := NewMemoryRevoker()
+	if err := r.Revoke("old", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	r.sweptAt = time.Time{}
+	_, f := testTime()
+	defer f()
+	if err := r.Revoke("new", time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.ids["old"]; ok {
+		t.Error("Expired id should be removed")
+	}
+}
+
+type testRevoker struct {
+	err error
+}
+
+func (r testRevoker) Revoke(string, time.Duration) error {
+	return r.err
+}
+
+func (r testRevoker) IsRevoked(string) (bool, error) {
+	return false, r.err
+}
@@ -0,0 +1,120 @@
+package ctxtg
+
+import (
+	"context"
+	"errors"
+	"net/rpc"
+	"reflect"
+)
+
+// RPCArgs is implemented by jsonrpc2 method args which embed Context
+type RPCArgs interface {
+	RPCContext() *Context
+}
+
+// RPCContext returns c itself, so pointer to any struct embedding Context implements RPCArgs
+func (c *Context) RPCContext() *Context {
+	return c
+}
+
+// RPCFunc is jsonrpc2 method body in which converted context.Context and JWT Claims will be passed if JWT Token is fine
+type RPCFunc[A RPCArgs, R any] func(ctx context.Context, claims Claims, args A, reply *R) error
+
+// WrapRPC returns function with net/rpc method signature which parses Context embedded into args with p
+// and calls f with converted context.Context and JWT Claims.
+// Data is checked with DefaultDataLimits before parsing, reserved keys are dropped.
+// ErrRevokerUnavailable is returned as ErrTokenCheckUnavailable, so Revoker errors aren't sent to clients.
+//
+//	type Args struct {
+//		ctxtg.Context
+//		ID int
+//	}
+//
+//	func (s *Service) Get(args *Args, reply *Reply) error {
+//		return ctxtg.WrapRPC(s.parser, s.get)(args, reply)
+//	}
+//
+//	func (s *Service) get(ctx context.Context, claims ctxtg.Claims, args *Args, reply *Reply) error {
+//		...
+//	}
+func WrapRPC[A RPCArgs, R any](p TokenParser, f RPCFunc[A, R]) func(A, *R) error {
+	return WrapRPCWithLimits(p, DefaultDataLimits(), f)
+}
+
+// WrapRPCWithLimits works like WrapRPC but checks Data with l
+func WrapRPCWithLimits[A RPCArgs, R any](p TokenParser, l DataLimits, f RPCFunc[A, R]) func(A, *R) error {
+	return func(args A, reply *R) error {
+		c := args.RPCContext()
+		l.dropReserved(c.Data)
+		if err := l.Check(c.Data); err != nil {
+			return err
+		}
+		err := p.ParseCtxWithClaims(*c, func(ctx context.Context, claims Claims) error {
+			return f(ctx, claims, args, reply)
+		})
+		if errors.Is(err, ErrRevokerUnavailable) {
+			return ErrTokenCheckUnavailable
+		}
+		return err
+	}
+}
+
+// RPCCaller is implemented by *rpc.Client and *jsonrpc2.Client
+type RPCCaller interface {
+	Go(serviceMethod string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call
+}
+
+// NewRPCClient returns RPCClient which makes calls with c
+func NewRPCClient(c RPCCaller) *RPCClient {
+	return &RPCClient{
+		caller: c,
+	}
+}
+
+// RPCClient makes jsonrpc2 calls filling Context embedded into args from context.Context
+type RPCClient struct {
+	// Budget enables sending time left until deadline, see FromContextWithBudget
+	Budget bool
+	// Source is used to get Token instead of context.Context if not nil
+	Source TokenSource
+	// Limits are used to check Data, DefaultDataLimits if nil
+	Limits *DataLimits
+
+	caller RPCCaller
+}
+
+// Call fills Context embedded into args with FromContext(ctx) and invokes serviceMethod.
+// Data is checked with Limits before sending, reserved keys are not allowed.
+// Global errors returned by remote service are converted to match them with errors.Is.
+// Call isn't sent if ctx is already done and Call returns ctx.Err() without waiting for reply
+// if ctx is done before reply received.
+// Reply is decoded into new value of reply type, which is copied to reply only if call succeeds
+// before ctx is done, so reply isn't written after Call returns.
+func (c *RPCClient) Call(ctx context.Context, serviceMethod string, args RPCArgs, reply interface{}) error {
+	rc, err := outgoingContext(ctx, c.Budget, c.Source)
+	if err != nil {
+		return err
+	}
+	*args.RPCContext() = rc
+	if err := limitsOrDefault(c.Limits).checkOutgoing(args.RPCContext().Data); err != nil {
+		return err
+	}
+	dst := reflect.ValueOf(reply)
+	callReply := reply
+	if dst.Kind() == reflect.Pointer && !dst.IsNil() {
+		callReply = reflect.New(dst.Elem().Type()).Interface()
+	}
+	call := c.caller.Go(serviceMethod, args, callReply, make(chan *rpc.Call, 1))
+	select {
+	case call = <-call.Done:
+		if call.Error != nil {
+			return clientError(call.Error)
+		}
+		if callReply != reply {
+			dst.Elem().Set(reflect.ValueOf(callReply).Elem())
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,273 @@
+package ctxtg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/rpc"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/powerman/rpc-codec/jsonrpc2"
+)
+
+type RPCTestArgs struct {
+	Context
+	A, B int
+}
+
+type RPCTestService struct {
+	parser TokenParser
+	ctx    Context
+	claims Claims
+}
+
+func (s *RPCTestService) Sum(args *RPCTestArgs, reply *int) error {
+	return WrapRPC(s.parser, s.sum)(args, reply)
+}
+
+func (s *RPCTestService) sum(ctx context.Context, claims Claims, args *RPCTestArgs, reply *int) error {
+	s.ctx = FromContext(ctx)
+	s.claims = claims
+	*reply = args.A + args.B
+	return nil
+}
+
+func TestWrapRPC(t *testing.T) {
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}))
+	svc := &RPCTestService{parser: testRSATokenParser(t)}
+	client := testRPCClient(t, svc)
+	defer client.Close()
+
+	deadline := time.Now().Add(10 * time.Second)
+	args := RPCTestArgs{
+		Context: Context{
+			Token:        token,
+			Deadline:     deadline.Unix(),
+			DeadlineNano: deadline.UnixNano(),
+			TracingID:    "123",
+			Data:         map[string]interface{}{"k": "v"},
+		},
+		A: 1,
+		B: 2,
+	}
+	var reply int
+	if err := client.Call("Test.Sum", args, &reply); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if reply != 3 {
+		t.Errorf("Invalid reply %v", reply)
+	}
+	if !reflect.DeepEqual(svc.ctx, args.Context) {
+		t.Errorf("Invalid context passed %v", svc.ctx)
+	}
+	if svc.claims.UserID != 3 {
+		t.Errorf("Invalid claims %v", svc.claims)
+	}
+}
+
+func TestWrapRPCErr(t *testing.T) {
+	svc := &RPCTestService{parser: testRSATokenParser(t)}
+	client := testRPCClient(t, svc)
+	defer client.Close()
+
+	args := RPCTestArgs{
+		Context: Context{
+			Token: "invalid",
+		},
+	}
+	var reply int
+	err := client.Call("Test.Sum", args, &reply)
+	if e := jsonrpc2.ServerError(err); e.Code != ErrInvalidToken.Code {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestWrapRPCDataLimits(t *testing.T) {
+	args := RPCTestArgs{
+		Context: Context{
+			Data: map[string]interface{}{strings.Repeat("k", DefaultDataLimits().MaxKeyLen+1): 1},
+		},
+	}
+	var reply int
+	err := (&RPCTestService{}).Sum(&args, &reply)
+	if !errors.Is(err, ErrDataKeyTooLong) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRPCDataReserved(t *testing.T) {
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}))
+	svc := &RPCTestService{parser: testRSATokenParser(t)}
+	jsonClient := testRPCClient(t, svc)
+	defer jsonClient.Close()
+
+	args := RPCTestArgs{
+		Context: Context{
+			Token: token,
+			Data:  map[string]interface{}{ReservedDataPrefix + "k": 1, "k": "v"},
+		},
+	}
+	var reply int
+	if err := jsonClient.Call("Test.Sum", args, &reply); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !reflect.DeepEqual(svc.ctx.Data, map[string]interface{}{"k": "v"}) {
+		t.Errorf("Reserved keys should be dropped %v", svc.ctx.Data)
+	}
+
+	ctx := WithDataValue(context.Background(), ReservedDataPrefix+"k", 1)
+	err := NewRPCClient(jsonClient).Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply)
+	if !errors.Is(err, ErrDataKeyReserved) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRPCLimits(t *testing.T) {
+	l := DataLimits{MaxKeys: 1}
+	args := RPCTestArgs{
+		Context: Context{Data: map[string]interface{}{"a": 1, "b": 2}},
+	}
+	var reply int
+	err := WrapRPCWithLimits(nil, l, (&RPCTestService{}).sum)(&args, &reply)
+	if !errors.Is(err, ErrDataTooManyKeys) {
+		t.Errorf("Unexpected error %v", err)
+	}
+
+	client := NewRPCClient(rpcCallerFunc(func(string, interface{}, interface{}, chan *rpc.Call) *rpc.Call {
+		t.Error("Should not be called")
+		return nil
+	}))
+	client.Limits = &l
+	ctx := WithDataValue(WithDataValue(context.Background(), "a", 1), "b", 2)
+	if err := client.Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply); !errors.Is(err, ErrDataTooManyKeys) {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func testRPCClient(t *testing.T, svc interface{}) *jsonrpc2.Client {
+	if jsonV2() {
+		t.Skip("rpc-codec v1.2.2 server overflows stack with encoding/json v2, run with GOEXPERIMENT=nojsonv2")
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Test", svc); err != nil {
+		t.Fatal(err)
+	}
+	srvConn, clientConn := net.Pipe()
+	go srv.ServeCodec(jsonrpc2.NewServerCodec(srvConn, srv))
+	return jsonrpc2.NewClient(clientConn)
+}
+
+func TestRPCClient(t *testing.T) {
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: time.Now().Add(5 * time.Second).Unix(),
+	}))
+	svc := &RPCTestService{parser: testRSATokenParser(t)}
+	jsonClient := testRPCClient(t, svc)
+	defer jsonClient.Close()
+
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, TokenKey, token)
+	ctx = context.WithValue(ctx, TracingIDKey, "123")
+	ctx = WithDataValue(ctx, "k", "v")
+	ctx, cancel := context.WithDeadline(ctx, time.Now().Add(10*time.Second))
+	defer cancel()
+
+	var reply int
+	err := NewRPCClient(jsonClient).Call(ctx, "Test.Sum", &RPCTestArgs{A: 1, B: 2}, &reply)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if reply != 3 {
+		t.Errorf("Invalid reply %v", reply)
+	}
+	if want := FromContext(ctx); !reflect.DeepEqual(svc.ctx, want) {
+		t.Errorf("Should be the same %v != %v", svc.ctx, want)
+	}
+}
+
+func TestRPCClientCanceled(t *testing.T) {
+	caller := rpcCallerFunc(func(string, interface{}, interface{}, chan *rpc.Call) *rpc.Call {
+		return &rpc.Call{Done: make(chan *rpc.Call)}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	var reply int
+	if err := NewRPCClient(caller).Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply); err != context.Canceled {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+func TestRPCClientCanceledReply(t *testing.T) {
+	var callReply *int
+	done := make(chan *rpc.Call, 1)
+	caller := rpcCallerFunc(func(_ string, _ interface{}, reply interface{}, _ chan *rpc.Call) *rpc.Call {
+		callReply = reply.(*int)
+		return &rpc.Call{Done: done}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	reply := 1
+	if err := NewRPCClient(caller).Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply); err != context.Canceled {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if callReply == &reply {
+		t.Fatal("Reply should be decoded into copy")
+	}
+	*callReply = 3
+	done <- &rpc.Call{}
+	if reply != 1 {
+		t.Errorf("Reply should not be written after Call returned %v", reply)
+	}
+}
+
+func TestRPCClientDeadlineExceeded(t *testing.T) {
+	caller := rpcCallerFunc(func(string, interface{}, interface{}, chan *rpc.Call) *rpc.Call {
+		t.Error("Should not be called")
+		return nil
+	})
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	var reply int
+	if err := NewRPCClient(caller).Call(ctx, "Test.Sum", &RPCTestArgs{}, &reply); err != context.DeadlineExceeded {
+		t.Errorf("Unexpected error %v", err)
+	}
+}
+
+// jsonV2 reports whether encoding/json calls UnmarshalJSON of named pointer types like json v2 does,
+// rpc-codec v1.2.2 server decodes requests this way and recurses infinitely
+func jsonV2() bool {
+	var p jsonProbe
+	_ = json.Unmarshal([]byte("{}"), &p)
+	return p.calls > 1
+}
+
+type jsonProbe struct {
+	calls int
+}
+
+func (p *jsonProbe) UnmarshalJSON(b []byte) error {
+	p.calls++
+	if p.calls > 1 {
+		return nil
+	}
+	type probe *jsonProbe
+	return json.Unmarshal(b, probe(p))
+}
+
+type rpcCallerFunc func(string, interface{}, interface{}, chan *rpc.Call) *rpc.Call
+
+func (f rpcCallerFunc) Go(serviceMethod string, args interface{}, reply interface{}, done chan *rpc.Call) *rpc.Call {
+	return f(serviceMethod, args, reply, done)
+}
@@ -1,20 +1,15 @@
 package ctxtg
 
 import (
-	"crypto/rsa"
+	"crypto"
+	"encoding/json"
 	"strconv"
+	"strings"
 	"time"
 
 	"context"
 
 	"github.com/dgrijalva/jwt-go"
-	"github.com/powerman/rpc-codec/jsonrpc2"
-)
-
-// Global errors for all projects
-var (
-	ErrInvalidToken = jsonrpc2.NewError(1, "INVALID_TOKEN")
-	ErrTokenExpired = jsonrpc2.NewError(2, "TOKEN_EXPIRED")
 )
 
 var timeNowFunc = time.Now
@@ -22,6 +17,95 @@ var timeNowFunc = time.Now
 // Claims represents encoded into JWT info
 type Claims struct {
 	UserID UserID
+	// Roles of user, "roles" claim
+	Roles []string
+	// Scopes granted to token, space separated "scope" claim
+	Scopes []string
+	// TenantID is tenant (organization) of user, "tid" claim
+	TenantID string
+	// SessionID is id of user session token issued for, "sid" claim
+	SessionID string
+	// TokenID is unique id of token, "jti" claim
+	TokenID string
+	// IssuedAt is time token was signed at, "iat" claim, set by TokenSigner
+	IssuedAt time.Time
+	// NotBefore is time token is valid since, "nbf" claim, set by TokenSigner, see WithNotBefore
+	NotBefore time.Time
+}
+
+// HasRole reports whether c contains role
+func (c Claims) HasRole(role string) bool {
+	return containsString(c.Roles, role)
+}
+
+// HasScope reports whether c contains scope
+func (c Claims) HasScope(scope string) bool {
+	return containsString(c.Scopes, scope)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// jwtClaims is JWT representation of Claims
+type jwtClaims struct {
+	jwt.StandardClaims
+	// Audience shadows StandardClaims.Audience, which doesn't support arrays
+	Audience  audience `json:"aud,omitempty"`
+	Roles     []string `json:"roles,omitempty"`
+	Scope     string   `json:"scope,omitempty"`
+	TenantID  string   `json:"tid,omitempty"`
+	SessionID string   `json:"sid,omitempty"`
+}
+
+func newJWTClaims(c Claims) jwtClaims {
+	return jwtClaims{
+		StandardClaims: jwt.StandardClaims{
+			Subject: strconv.FormatInt(int64(c.UserID), 10),
+			Id:      c.TokenID,
+		},
+		Roles:     c.Roles,
+		Scope:     strings.Join(c.Scopes, " "),
+		TenantID:  c.TenantID,
+		SessionID: c.SessionID,
+	}
+}
+
+func (c *jwtClaims) claims() (*Claims, error) {
+	if c.Subject == "" {
+		return nil, ErrMissingSubject
+	}
+	userID, err := strconv.ParseInt(c.Subject, 10, 0)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var scopes []string
+	if c.Scope != "" {
+		scopes = strings.Fields(c.Scope)
+	}
+	return &Claims{
+		UserID:    UserID(userID),
+		Roles:     c.Roles,
+		Scopes:    scopes,
+		TenantID:  c.TenantID,
+		SessionID: c.SessionID,
+		TokenID:   c.Id,
+		IssuedAt:  unixTime(c.IssuedAt),
+		NotBefore: unixTime(c.NotBefore),
+	}, nil
+}
+
+// unixTime returns zero time.Time for zero sec
+func unixTime(sec int64) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
 }
 
 // UserID represents user id in Timeguard system
@@ -41,24 +125,76 @@ type TokenParser interface {
 }
 
 // NewRSATokenParser parse publicKey and return correct instance or error
-func NewRSATokenParser(publicKey []byte) (*RSATokenParser, error) {
+func NewRSATokenParser(publicKey []byte, opts ...ParserOption) (*RSATokenParser, error) {
 	k, err := jwt.ParseRSAPublicKeyFromPEM(publicKey)
 	if err != nil {
 		return nil, err
 	}
 	return &RSATokenParser{
-		publicKey: k,
+		jwtParser: newJWTParser(publicKeyFunc(k), opts),
 	}, nil
 }
 
 // RSATokenParser for parsing JWT token
 // Implements TokenParser
 type RSATokenParser struct {
-	publicKey *rsa.PublicKey
+	jwtParser
+}
+
+// ParserOption configures TokenParser on creation
+type ParserOption func(*jwtParser)
+
+// RequireIssuer makes TokenParser to reject tokens without "iss" claim equal to iss with ErrInvalidIssuer
+func RequireIssuer(iss string) ParserOption {
+	return func(p *jwtParser) {
+		p.issuer = iss
+	}
+}
+
+// RequireAudience makes TokenParser to reject tokens without any of aud in "aud" claim with ErrInvalidAudience
+func RequireAudience(aud ...string) ParserOption {
+	return func(p *jwtParser) {
+		p.audience = aud
+	}
+}
+
+// WithLeeway makes TokenParser to tolerate clock skew up to leeway
+// while validating "exp", "nbf" and "iat" claims
+func WithLeeway(leeway time.Duration) ParserOption {
+	return func(p *jwtParser) {
+		p.leeway = leeway
+	}
+}
+
+// WithClock makes TokenParser to use now as current time while validating "exp", "nbf" and "iat" claims
+// and grace periods of retired keys
+func WithClock(now func() time.Time) ParserOption {
+	return func(p *jwtParser) {
+		p.now = now
+	}
+}
+
+// jwtParser implements TokenParser for JWT tokens verified with key returned by keyFunc
+type jwtParser struct {
+	keyFunc  jwt.Keyfunc
+	issuer   string
+	audience []string
+	leeway   time.Duration
+	now      func() time.Time
+}
+
+func newJWTParser(keyFunc jwt.Keyfunc, opts []ParserOption) jwtParser {
+	p := jwtParser{
+		keyFunc: keyFunc,
+	}
+	for _, o := range opts {
+		o(&p)
+	}
+	return p
 }
 
 // ParseCtxWithClaims takes context, parse JWT token, convert context and, if token valid, calls f with converted context and JWT Claims
-func (p *RSATokenParser) ParseCtxWithClaims(context Context, f CtxClaimsFunc) error {
+func (p *jwtParser) ParseCtxWithClaims(context Context, f CtxClaimsFunc) error {
 	c, err := p.Parse(context.Token)
 	if err != nil {
 		return err
@@ -69,7 +205,7 @@ func (p *RSATokenParser) ParseCtxWithClaims(context Context, f CtxClaimsFunc) er
 }
 
 // ParseWithClaims takes t, parse JWT token and, if token valid, calls f with JWT Claims
-func (p *RSATokenParser) ParseWithClaims(t Token, f ClaimsFunc) error {
+func (p *jwtParser) ParseWithClaims(t Token, f ClaimsFunc) error {
 	c, err := p.Parse(t)
 	if err != nil {
 		return err
@@ -78,35 +214,58 @@ func (p *RSATokenParser) ParseWithClaims(t Token, f ClaimsFunc) error {
 }
 
 // Parse JWT token and return Claims or error
-func (p *RSATokenParser) Parse(t Token) (*Claims, error) {
-	var claims jwt.StandardClaims
-	token, err := jwt.ParseWithClaims(string(t), &claims, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodRSA); !ok {
-			return nil, ErrInvalidToken
-		}
-		return p.publicKey, nil
-	})
+func (p *jwtParser) Parse(t Token) (*Claims, error) {
+	c, _, err := p.parse(t)
+	return c, err
+}
+
+// parse JWT token and return Claims with parsed jwt.Token or error
+func (p *jwtParser) parse(t Token) (*Claims, *jwt.Token, error) {
+	var claims jwtClaims
+	parser := jwt.Parser{
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.ParseWithClaims(string(t), &claims, p.keyFunc)
 	if token != nil && token.Valid {
-		userID, err := strconv.ParseInt(claims.Subject, 10, 0)
-		if err != nil {
-			return nil, ErrInvalidToken
+		if err := p.validate(&claims); err != nil {
+			return nil, nil, err
 		}
-		return &Claims{
-			UserID: UserID(userID),
-		}, nil
-	}
-
-	if ve, ok := err.(*jwt.ValidationError); ok {
-		if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-			return nil, ErrInvalidToken
-		} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
-			return nil, ErrTokenExpired
-		} else {
-			return nil, ve
+		c, err := claims.claims()
+		if err != nil {
+			return nil, nil, err
 		}
-	} else {
-		return nil, err
+		return c, token, nil
+	}
+	return nil, nil, validationError(err)
+}
+
+// timeNow returns current time of parser clock, see WithClock
+func (p *jwtParser) timeNow() time.Time {
+	if p.now != nil {
+		return p.now()
 	}
+	return timeNowFunc()
+}
+
+// validate checks claims against parser requirements
+func (p *jwtParser) validate(c *jwtClaims) error {
+	now := p.timeNow()
+	if c.ExpiresAt != 0 && now.After(time.Unix(c.ExpiresAt, 0).Add(p.leeway)) {
+		return tokenTimeError(ErrTokenExpired, c, now)
+	}
+	if c.NotBefore != 0 && now.Add(p.leeway).Before(time.Unix(c.NotBefore, 0)) {
+		return tokenTimeError(ErrTokenNotValidYet, c, now)
+	}
+	if c.IssuedAt != 0 && now.Add(p.leeway).Before(time.Unix(c.IssuedAt, 0)) {
+		return tokenTimeError(ErrTokenUsedBeforeIssued, c, now)
+	}
+	if p.issuer != "" && c.Issuer != p.issuer {
+		return ErrInvalidIssuer
+	}
+	if len(p.audience) != 0 && !c.Audience.containsAny(p.audience) {
+		return ErrInvalidAudience
+	}
+	return nil
 }
 
 // TokenSigner interface for JWT token signing and point for mocking (see ctxtgtest subpackage)
@@ -115,13 +274,13 @@ type TokenSigner interface {
 }
 
 // NewRSATokenSigner parse privateKey and return correct instance
-func NewRSATokenSigner(privateKey []byte) (*RSATokenSigner, error) {
+func NewRSATokenSigner(privateKey []byte, opts ...SignerOption) (*RSATokenSigner, error) {
 	k, err := jwt.ParseRSAPrivateKeyFromPEM(privateKey)
 	if err != nil {
 		return nil, err
 	}
 	return &RSATokenSigner{
-		privateKey: k,
+		jwtSigner: newJWTSigner(jwt.SigningMethodRS256, k, opts),
 	}, nil
 
 }
@@ -129,14 +288,146 @@ func NewRSATokenSigner(privateKey []byte) (*RSATokenSigner, error) {
 // RSATokenSigner for signing JWT tokens
 // Implements TokenSigner
 type RSATokenSigner struct {
-	privateKey *rsa.PrivateKey
+	jwtSigner
+}
+
+// SignerOption configures TokenSigner on creation
+type SignerOption func(*jwtSigner)
+
+// WithKeyID makes TokenSigner to stamp "kid" header of signed tokens,
+// so parsers can select verification key, see KeySetTokenParser
+func WithKeyID(kid string) SignerOption {
+	return func(s *jwtSigner) {
+		s.kid = kid
+	}
+}
+
+// WithIssuer makes TokenSigner to stamp "iss" claim of signed tokens, see RequireIssuer
+func WithIssuer(iss string) SignerOption {
+	return func(s *jwtSigner) {
+		s.issuer = iss
+	}
+}
+
+// WithAudience makes TokenSigner to stamp "aud" claim of signed tokens, see RequireAudience
+func WithAudience(aud ...string) SignerOption {
+	return func(s *jwtSigner) {
+		s.audience = aud
+	}
+}
+
+// WithNotBefore makes TokenSigner to stamp "nbf" claim of signed tokens
+// with signing time plus offset, negative offset tolerates verifiers clock skew
+func WithNotBefore(offset time.Duration) SignerOption {
+	return func(s *jwtSigner) {
+		s.notBefore = &offset
+	}
+}
+
+// jwtSigner implements TokenSigner signing JWT tokens with key using method
+type jwtSigner struct {
+	method    jwt.SigningMethod
+	key       interface{}
+	kid       string
+	issuer    string
+	audience  audience
+	notBefore *time.Duration
+}
+
+func newJWTSigner(method jwt.SigningMethod, key interface{}, opts []SignerOption) jwtSigner {
+	s := jwtSigner{
+		method: method,
+		key:    key,
+	}
+	for _, o := range opts {
+		o(&s)
+	}
+	return s
+}
+
+// KeyID returns "kid" header stamped into signed tokens
+func (s *jwtSigner) KeyID() string {
+	return s.kid
 }
 
-// Sign and encode c with timeout, returns signed Token or error
-func (r *RSATokenSigner) Sign(c Claims, timeout time.Duration) (Token, error) {
-	t, err := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
-		Subject:   strconv.FormatInt(int64(c.UserID), 10),
-		ExpiresAt: timeNowFunc().Add(timeout).Unix(),
-	}).SignedString(r.privateKey)
+// Alg returns JWT signing method name ("alg" header) of signed tokens
+func (s *jwtSigner) Alg() string {
+	return s.method.Alg()
+}
+
+// PublicKey returns public half of signing key
+func (s *jwtSigner) PublicKey() crypto.PublicKey {
+	return s.key.(crypto.Signer).Public()
+}
+
+// Sign and encode c with timeout, returns signed Token or error.
+// Token gets random "jti" unless c.TokenID is set, "iat" is set to current time.
+func (s *jwtSigner) Sign(c Claims, timeout time.Duration) (Token, error) {
+	claims, err := s.jwtClaims(c, timeout)
+	if err != nil {
+		return "", err
+	}
+	return s.sign(claims)
+}
+
+// jwtClaims returns JWT claims for c expiring after timeout
+func (s *jwtSigner) jwtClaims(c Claims, timeout time.Duration) (jwtClaims, error) {
+	now := timeNowFunc()
+	claims := newJWTClaims(c)
+	if claims.Id == "" {
+		id, err := randomID(16)
+		if err != nil {
+			return jwtClaims{}, err
+		}
+		claims.Id = id
+	}
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(timeout).Unix()
+	if s.notBefore != nil {
+		claims.NotBefore = now.Add(*s.notBefore).Unix()
+	}
+	claims.Issuer = s.issuer
+	claims.Audience = s.audience
+	return claims, nil
+}
+
+func (s *jwtSigner) sign(claims jwt.Claims) (Token, error) {
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.kid != "" {
+		token.Header["kid"] = s.kid
+	}
+	t, err := token.SignedString(s.key)
 	return Token(t), err
 }
+
+// audience is "aud" claim, encoded as string if it contains single value and as array otherwise
+type audience []string
+
+func (a audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*a = nil
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) containsAny(aud []string) bool {
+	for _, v := range aud {
+		if containsString(a, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package ctxtg
 import (
 	"context"
 	"crypto/rsa"
+	"encoding/json"
 	"errors"
 	"reflect"
 	"strconv"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/powerman/rpc-codec/jsonrpc2"
 )
 
 func TestParseCtxWithClaims(t *testing.T) {
@@ -174,7 +176,7 @@ func TestRSATokenParserExpiredTest(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error")
 	}
-	if err != ErrTokenExpired {
+	if !errors.Is(err, ErrTokenExpired) {
 		t.Errorf("TokenExpired error expected %v %T", err, err)
 	}
 }
@@ -234,8 +236,16 @@ func TestRSATokenStringUserID(t *testing.T) {
 	if err == nil {
 		t.Error("Expected error")
 	}
-	if err != ErrInvalidToken {
-		t.Errorf("TokenExpired error expected %v %T", err, err)
+	if err != ErrMissingSubject {
+		t.Errorf("MissingSubject error expected %v %T", err, err)
+	}
+
+	token = jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "id3",
+		"exp": time.Now().Add(5 * time.Second).Unix(),
+	})
+	if _, err := p.Parse(signToken(t, token)); err != ErrInvalidToken {
+		t.Errorf("Invalid token error expected %v %T", err, err)
 	}
 }
 
@@ -260,6 +270,261 @@ func TestRSATokenSigner(t *testing.T) {
 	}
 }
 
+func TestTokenSignerParserClaims(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	s := testRSATokenSigner(t)
+	p := testRSATokenParser(t)
+	tests := []Claims{
+		{UserID: 3},
+		{
+			UserID:    3,
+			Roles:     []string{"admin", "user"},
+			Scopes:    []string{"tracker:read", "tracker:write"},
+			TenantID:  "acme",
+			SessionID: "s1",
+			TokenID:   "t1",
+		},
+	}
+	for _, claims := range tests {
+		token, err := s.Sign(claims, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := p.Parse(token)
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if claims.TokenID == "" {
+			claims.TokenID = c.TokenID
+		}
+		claims.IssuedAt = time.Unix(now.Unix(), 0)
+		if !reflect.DeepEqual(*c, claims) {
+			t.Errorf("Invalid claims %#v, expected %#v", *c, claims)
+		}
+	}
+}
+
+func TestTokenSignerStamps(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	s, err := NewRSATokenSigner(privateRSA, WithNotBefore(-2*time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := testRSATokenParser(t)
+	var tokens []Token
+	for i := 0; i < 2; i++ {
+		token, err := s.Sign(Claims{UserID: 3}, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tokens = append(tokens, token)
+	}
+	if tokens[0] == tokens[1] {
+		t.Error("Tokens should be unique")
+	}
+	c0, err := p.Parse(tokens[0])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	c1, err := p.Parse(tokens[1])
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c0.TokenID == "" || c0.TokenID == c1.TokenID {
+		t.Errorf("Invalid token ids %v %v", c0.TokenID, c1.TokenID)
+	}
+	if !c0.IssuedAt.Equal(time.Unix(now.Unix(), 0)) {
+		t.Errorf("Invalid IssuedAt %v", c0.IssuedAt)
+	}
+	if !c0.NotBefore.Equal(time.Unix(now.Add(-2*time.Second).Unix(), 0)) {
+		t.Errorf("Invalid NotBefore %v", c0.NotBefore)
+	}
+
+	s, err = NewRSATokenSigner(privateRSA, WithNotBefore(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.Sign(Claims{UserID: 3}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Parse(token); !errors.Is(err, ErrTokenNotValidYet) {
+		t.Errorf("Expected ErrTokenNotValidYet, got %v", err)
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":   "3",
+		"exp":   time.Now().Add(5 * time.Second).Unix(),
+		"roles": []string{"admin"},
+		"scope": " tracker:read  tracker:write ",
+		"tid":   "acme",
+	}))
+	c, err := testRSATokenParser(t).Parse(token)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !c.HasRole("admin") || c.HasRole("user") {
+		t.Errorf("Invalid roles %v", c.Roles)
+	}
+	if !c.HasScope("tracker:read") || !c.HasScope("tracker:write") || len(c.Scopes) != 2 {
+		t.Errorf("Invalid scopes %q", c.Scopes)
+	}
+	if c.TenantID != "acme" || c.SessionID != "" {
+		t.Errorf("Invalid claims %v", c)
+	}
+}
+
+func TestTokenParserIssuerAudience(t *testing.T) {
+	p, err := NewRSATokenParser(publicRSA, RequireIssuer("auth"), RequireAudience("tracker", "billing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		opts []SignerOption
+		err  error
+	}{
+		{[]SignerOption{WithIssuer("auth"), WithAudience("tracker")}, nil},
+		{[]SignerOption{WithIssuer("auth"), WithAudience("other", "billing")}, nil},
+		{[]SignerOption{WithIssuer("other"), WithAudience("tracker")}, ErrInvalidIssuer},
+		{[]SignerOption{WithAudience("tracker")}, ErrInvalidIssuer},
+		{[]SignerOption{WithIssuer("auth"), WithAudience("other")}, ErrInvalidAudience},
+		{[]SignerOption{WithIssuer("auth")}, ErrInvalidAudience},
+	}
+	for _, test := range tests {
+		s, err := NewRSATokenSigner(privateRSA, test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token, err := s.Sign(Claims{UserID: 3}, 5*time.Second)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := p.Parse(token); err != test.err {
+			t.Errorf("Expected error %v, got %v", test.err, err)
+		}
+	}
+
+	token, err := testRSATokenSigner(t).Sign(Claims{UserID: 3}, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := testRSATokenParser(t).Parse(token); err != nil {
+		t.Errorf("Issuer and audience should not be required by default %v", err)
+	}
+}
+
+func TestTokenParserLeeway(t *testing.T) {
+	now := time.Unix(1500000000, 0)
+	clock := func() time.Time {
+		return now
+	}
+	tests := []struct {
+		claims jwt.StandardClaims
+		err    error
+	}{
+		{jwt.StandardClaims{ExpiresAt: now.Unix() - 1}, nil},
+		{jwt.StandardClaims{ExpiresAt: now.Unix() - 3}, ErrTokenExpired},
+		{jwt.StandardClaims{ExpiresAt: now.Unix() + 5, NotBefore: now.Unix() + 1}, nil},
+		{jwt.StandardClaims{ExpiresAt: now.Unix() + 5, NotBefore: now.Unix() + 3}, ErrTokenNotValidYet},
+		{jwt.StandardClaims{ExpiresAt: now.Unix() + 5, IssuedAt: now.Unix() + 1}, nil},
+		{jwt.StandardClaims{ExpiresAt: now.Unix() + 5, IssuedAt: now.Unix() + 3}, ErrTokenUsedBeforeIssued},
+	}
+	p, err := NewRSATokenParser(publicRSA, WithLeeway(2*time.Second), WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		test.claims.Subject = "3"
+		token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, test.claims))
+		if _, err := p.Parse(token); !errors.Is(err, test.err) {
+			t.Errorf("Expected error %v for %v, got %v", test.err, test.claims, err)
+		}
+	}
+}
+
+func TestTokenParserClock(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.StandardClaims{
+		Subject:   "3",
+		ExpiresAt: now.Add(-5 * time.Second).Unix(),
+	}))
+	if _, err := testRSATokenParser(t).Parse(token); !errors.Is(err, ErrTokenExpired) {
+		t.Errorf("Expected ErrTokenExpired, got %v", err)
+	}
+}
+
+func TestTokenTimeError(t *testing.T) {
+	now, f := testTime()
+	defer f()
+	tests := []struct {
+		claims jwt.StandardClaims
+		err    *jsonrpc2.Error
+	}{
+		{jwt.StandardClaims{ExpiresAt: now.Unix() - 5}, ErrTokenExpired},
+		{jwt.StandardClaims{ExpiresAt: now.Unix() + 5, NotBefore: now.Unix() + 3}, ErrTokenNotValidYet},
+	}
+	for _, test := range tests {
+		test.claims.Subject = "3"
+		token := signToken(t, jwt.NewWithClaims(jwt.SigningMethodRS256, test.claims))
+		_, err := testRSATokenParser(t).Parse(token)
+		if !errors.Is(err, test.err) {
+			t.Fatalf("Expected error %v, got %v", test.err, err)
+		}
+		expected := TokenTime{
+			ExpiresAt: test.claims.ExpiresAt,
+			NotBefore: test.claims.NotBefore,
+			Now:       now.Unix(),
+		}
+		if tt, ok := TokenTimeFromError(err); !ok || tt != expected {
+			t.Errorf("Invalid TokenTime %v", tt)
+		}
+
+		// as received by jsonrpc2 client
+		remote := jsonrpc2.ServerError(errors.New(err.Error()))
+		if remote.Code != test.err.Code {
+			t.Errorf("Invalid remote error %v", remote)
+		}
+		if tt, ok := TokenTimeFromError(remote); !ok || tt != expected {
+			t.Errorf("Invalid remote TokenTime %v", tt)
+		}
+	}
+	if _, ok := TokenTimeFromError(ErrInvalidToken); ok {
+		t.Error("ErrInvalidToken has no TokenTime")
+	}
+}
+
+func TestAudienceJSON(t *testing.T) {
+	tests := []struct {
+		aud  audience
+		json string
+	}{
+		{audience{"a"}, `"a"`},
+		{audience{"a", "b"}, `["a","b"]`},
+	}
+	for _, test := range tests {
+		b, err := json.Marshal(test.aud)
+		if err != nil || string(b) != test.json {
+			t.Errorf("Invalid encoding %s %v", b, err)
+		}
+		var aud audience
+		if err := json.Unmarshal(b, &aud); err != nil || !reflect.DeepEqual(aud, test.aud) {
+			t.Errorf("Invalid decoding %v %v", aud, err)
+		}
+	}
+	var aud audience
+	if err := json.Unmarshal([]byte("null"), &aud); err != nil || aud != nil {
+		t.Errorf("Invalid decoding %v %v", aud, err)
+	}
+	if err := json.Unmarshal([]byte("1"), &aud); err == nil {
+		t.Error("Expected error")
+	}
+}
+
 func TestRSATokenSignerInvalidKey(t *testing.T) {
 	_, err := NewRSATokenSigner([]byte("invalidkey"))
 	if err == nil {
@@ -279,7 +544,10 @@ func testTime() (time.Time, func()) {
 
 func parseToken(t *testing.T, token Token) (Claims, int64) {
 	var c jwt.StandardClaims
-	_, err := jwt.ParseWithClaims(string(token), &c, func(*jwt.Token) (interface{}, error) {
+	parser := jwt.Parser{
+		SkipClaimsValidation: true,
+	}
+	_, err := parser.ParseWithClaims(string(token), &c, func(*jwt.Token) (interface{}, error) {
 		return testPublicKey(t), nil
 	})
 	if err != nil {
@@ -0,0 +1,197 @@
+package ctxtg
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Defaults for TokenSourceConfig
+const (
+	DefaultRenewBefore   = time.Minute
+	DefaultRetryInterval = 5 * time.Second
+)
+
+// TokenSource returns Token for outgoing calls, see Transport.Source and RPCClient.Source
+type TokenSource interface {
+	Token(context.Context) (Token, error)
+}
+
+// WithToken returns copy of ctx with Token returned by s
+func WithToken(ctx context.Context, s TokenSource) (context.Context, error) {
+	t, err := s.Token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return context.WithValue(ctx, TokenKey, t), nil
+}
+
+// RenewFunc returns new Token with its expiration time
+type RenewFunc func(context.Context) (Token, time.Time, error)
+
+// TokenSourceConfig configures RenewingTokenSource
+type TokenSourceConfig struct {
+	// RenewBefore is how long before expiration Token is renewed, DefaultRenewBefore if 0.
+	// Tokens with lifetime shorter than 2*RenewBefore are renewed at half of lifetime.
+	RenewBefore time.Duration
+	// RetryInterval between failed renewals, DefaultRetryInterval if 0
+	RetryInterval time.Duration
+}
+
+// NewSignerTokenSource returns RenewingTokenSource which signs c with timeout using s
+func NewSignerTokenSource(s TokenSigner, c Claims, timeout time.Duration, cfg TokenSourceConfig) *RenewingTokenSource {
+	return NewRenewingTokenSource(func(context.Context) (Token, time.Time, error) {
+		expiresAt := time.Unix(timeNowFunc().Add(timeout).Unix(), 0)
+		t, err := s.Sign(c, timeout)
+		return t, expiresAt, err
+	}, cfg)
+}
+
+// NewRenewingTokenSource returns RenewingTokenSource which gets tokens with renew.
+// First Token is requested in background immediately.
+func NewRenewingTokenSource(renew RenewFunc, cfg TokenSourceConfig) *RenewingTokenSource {
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = DefaultRenewBefore
+	}
+	if cfg.RetryInterval <= 0 {
+		cfg.RetryInterval = DefaultRetryInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &RenewingTokenSource{
+		renew:  renew,
+		cfg:    cfg,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	go s.renewLoop()
+	return s
+}
+
+// RenewingTokenSource caches Token and renews it in background before expiration.
+// Token renews it synchronously if cached one has expired.
+// It is safe for concurrent use.
+type RenewingTokenSource struct {
+	renew RenewFunc
+	cfg   TokenSourceConfig
+
+	// renewMu serializes renewals
+	renewMu sync.Mutex
+
+	mu        sync.Mutex
+	token     Token
+	expiresAt time.Time
+	renewAt   time.Time
+
+	wake   chan struct{}
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Token returns cached Token or renews it if cached one has expired
+func (s *RenewingTokenSource) Token(ctx context.Context) (Token, error) {
+	if t, ok := s.current(); ok {
+		return t, nil
+	}
+	s.renewMu.Lock()
+	defer s.renewMu.Unlock()
+	if t, ok := s.current(); ok {
+		return t, nil
+	}
+	return s.renewToken(ctx)
+}
+
+// Close stops background renewal and waits until it returns
+func (s *RenewingTokenSource) Close() error {
+	s.cancel()
+	<-s.done
+	return nil
+}
+
+func (s *RenewingTokenSource) current() (Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.token, s.token != "" && timeNowFunc().Before(s.expiresAt)
+}
+
+// renewToken must be called with renewMu locked
+func (s *RenewingTokenSource) renewToken(ctx context.Context) (Token, error) {
+	t, expiresAt, err := s.renew(ctx)
+	now := timeNowFunc()
+	s.mu.Lock()
+	switch {
+	case err != nil:
+		s.renewAt = now.Add(s.cfg.RetryInterval)
+	case !expiresAt.After(now):
+		s.token = t
+		s.expiresAt = expiresAt
+		s.renewAt = now.Add(s.cfg.RetryInterval)
+	default:
+		renewBefore := s.cfg.RenewBefore
+		if lifetime := expiresAt.Sub(now); lifetime < 2*renewBefore {
+			renewBefore = lifetime / 2
+		}
+		s.token = t
+		s.expiresAt = expiresAt
+		s.renewAt = expiresAt.Add(-renewBefore)
+	}
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return t, err
+}
+
+func (s *RenewingTokenSource) renewLoop() {
+	defer close(s.done)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+		case <-s.wake:
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+		case <-s.ctx.Done():
+			return
+		}
+		s.mu.Lock()
+		wait := s.renewAt.Sub(timeNowFunc())
+		s.mu.Unlock()
+		if wait <= 0 {
+			s.renewMu.Lock()
+			s.mu.Lock()
+			due := !timeNowFunc().Before(s.renewAt)
+			s.mu.Unlock()
+			if due {
+				_, _ = s.renewToken(s.ctx)
+			}
+			s.renewMu.Unlock()
+			continue
+		}
+		timer.Reset(wait)
+	}
+}
+
+// outgoingContext returns Context for outgoing call from ctx with Token from src if it is not nil
+func outgoingContext(ctx context.Context, budget bool, src TokenSource) (Context, error) {
+	if err := contextErr(ctx); err != nil {
+		return Context{}, err
+	}
+	c := fromContext(ctx, budget)
+	if src != nil {
+		t, err := src.Token(ctx)
+		if err != nil {
+			return Context{}, err
+		}
+		c.Token = t
+	}
+	return c, nil
+}
@@ -0,0 +1,175 @@
+package ctxtg
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRenewingTokenSource(t *testing.T) {
+	renew, count := testRenewFunc(time.Hour, nil)
+	s := NewRenewingTokenSource(renew, TokenSourceConfig{})
+	defer s.Close()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := s.Token(context.Background()); err != nil || token != "1" {
+				t.Errorf("Unexpected token %v %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := count(); n != 1 {
+		t.Errorf("Token should be renewed once, renewed %v times", n)
+	}
+}
+
+func TestRenewingTokenSourceBackground(t *testing.T) {
+	renew, count := testRenewFunc(200*time.Millisecond, nil)
+	s := NewRenewingTokenSource(renew, TokenSourceConfig{RenewBefore: 50 * time.Millisecond})
+	for i := 0; i < 100 && count() < 3; i++ {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if n := count(); n < 3 {
+		t.Errorf("Token should be renewed in background, renewed %v times", n)
+	}
+	token, err := s.Token(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := strconv.Atoi(string(token)); n < 3 {
+		t.Errorf("Token should be renewed %v", token)
+	}
+
+	s.Close()
+	n := count()
+	time.Sleep(300 * time.Millisecond)
+	if count() != n {
+		t.Error("Token should not be renewed after Close")
+	}
+}
+
+func TestRenewingTokenSourceErr(t *testing.T) {
+	renewErr := errors.New("renew err")
+	renew, count := testRenewFunc(time.Hour, renewErr)
+	s := NewRenewingTokenSource(renew, TokenSourceConfig{RetryInterval: 10 * time.Millisecond})
+	defer s.Close()
+	if _, err := s.Token(context.Background()); err != renewErr {
+		t.Errorf("Expected renew error, got %v", err)
+	}
+	for i := 0; i < 100 && count() < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := count(); n < 3 {
+		t.Errorf("Renewal should be retried, renewed %v times", n)
+	}
+}
+
+func TestRenewingTokenSourceExpired(t *testing.T) {
+	renew, count := testRenewFunc(-time.Second, nil)
+	s := NewRenewingTokenSource(renew, TokenSourceConfig{RetryInterval: time.Hour})
+	defer s.Close()
+	for i := 0; i < 3; i++ {
+		token, err := s.Token(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != Token(strconv.Itoa(count())) {
+			t.Errorf("Expired token should be renewed, got %v", token)
+		}
+	}
+	if n := count(); n < 3 || n > 4 {
+		t.Errorf("Expired token should be renewed on each call, renewed %v times", n)
+	}
+}
+
+func TestSignerTokenSource(t *testing.T) {
+	s := NewSignerTokenSource(testRSATokenSigner(t), Claims{UserID: 3}, time.Minute, TokenSourceConfig{})
+	defer s.Close()
+	ctx, err := WithToken(context.Background(), s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := testRSATokenParser(t).Parse(FromContext(ctx).Token)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if c.UserID != 3 {
+		t.Errorf("Invalid claims %v", c)
+	}
+}
+
+func TestTransportSource(t *testing.T) {
+	var token string
+	tr := &Transport{
+		Base: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			token = r.Header.Get(TokenHeader)
+			return nil, nil
+		}),
+		Source: testTokenSource{token: "fresh"},
+	}
+	ctx := context.WithValue(context.Background(), TokenKey, Token("stale"))
+	r := httptest.NewRequest("GET", "/", nil).WithContext(ctx)
+	if _, err := tr.RoundTrip(r); err != nil {
+		t.Fatal(err)
+	}
+	if token != "fresh" {
+		t.Errorf("Token from Source expected, got %v", token)
+	}
+
+	sourceErr := errors.New("source err")
+	tr.Source = testTokenSource{err: sourceErr}
+	if _, err := tr.RoundTrip(r); err != sourceErr {
+		t.Errorf("Expected source error, got %v", err)
+	}
+}
+
+func TestRPCClientSource(t *testing.T) {
+	s := NewSignerTokenSource(testRSATokenSigner(t), Claims{UserID: 3}, time.Minute, TokenSourceConfig{})
+	defer s.Close()
+	svc := &RPCTestService{parser: testRSATokenParser(t)}
+	jsonClient := testRPCClient(t, svc)
+	defer jsonClient.Close()
+	client := NewRPCClient(jsonClient)
+	client.Source = s
+
+	ctx := context.WithValue(context.Background(), TokenKey, Token("stale"))
+	var reply int
+	if err := client.Call(ctx, "Test.Sum", &RPCTestArgs{A: 1, B: 2}, &reply); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if svc.claims.UserID != 3 {
+		t.Errorf("Invalid claims %v", svc.claims)
+	}
+}
+
+// testRenewFunc returns RenewFunc returning tokens "1", "2", ... with lifetime and renewals counter
+func testRenewFunc(lifetime time.Duration, err error) (RenewFunc, func() int) {
+	var n int64
+	return func(context.Context) (Token, time.Time, error) {
+			i := atomic.AddInt64(&n, 1)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			return Token(strconv.FormatInt(i, 10)), timeNowFunc().Add(lifetime), nil
+		}, func() int {
+			return int(atomic.LoadInt64(&n))
+		}
+}
+
+type testTokenSource struct {
+	token Token
+	err   error
+}
+
+func (s testTokenSource) Token(context.Context) (Token, error) {
+	return s.token, s.err
+}